@@ -1,13 +1,21 @@
 package json
 
 import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"reflect"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
 	"unsafe"
 )
 
@@ -42,6 +50,12 @@ type jsonReport struct {
 	depth    int
 	messages []string
 	depths   []int
+	err      error
+}
+
+// Err is the first reason the plan can't decode everything, if there is one
+func (j jsonReport) Err() error {
+	return j.err
 }
 
 func (j *jsonReport) Deeper() func() {
@@ -70,9 +84,31 @@ type jsonDecoder interface {
 
 type jsonStoredProcedure interface {
 	IntoPointer(decodeOperation, int, int, unsafe.Pointer) (int, error)
+	FromPointer(*encodeState, []byte, unsafe.Pointer) ([]byte, error)
 	ReportPlan(*jsonReport)
 }
 
+// Unmarshaler is the same as the one in encoding/json, so types that decode themselves there do here too
+type Unmarshaler interface {
+	UnmarshalJSON([]byte) error
+}
+
+// Marshaler is the same as the one in encoding/json, so types that write themselves there do here too
+type Marshaler interface {
+	MarshalJSON() ([]byte, error)
+}
+
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// interfaceType is interface{}, whose plan skips over any value at all
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
 type describer interface {
 	ReportPlan(i interface{}) jsonReport
 	Describe(t reflect.Type) jsonStoredProcedure
@@ -104,8 +140,341 @@ var ErrNoBraceOpen = errors.New(`expected {`)
 
 var ErrNoQuoteOpen = errors.New(`expected opening "`)
 
+var ErrNoDigits = errors.New(`expected digits`)
+
+var ErrNotInteger = errors.New(`expected an integer`)
+
+var ErrNumberOverflow = errors.New(`number out of range`)
+
+var ErrUnsupportedFloat = errors.New(`cannot write NaN or infinity`)
+
+var ErrNoBool = errors.New(`expected true or false`)
+
+var ErrNoNull = errors.New(`expected null`)
+
+var ErrControlCharacter = errors.New(`invalid control character in string`)
+
+var ErrInvalidEscape = errors.New(`invalid escape in string`)
+
+var ErrUnexportedEmbedded = errors.New(`cannot create an embedded pointer to an unexported struct`)
+
+var ErrInvalidNumber = errors.New(`invalid number literal`)
+
+var ErrInvalidQuoted = errors.New(`expected only a number or bool inside the quotes`)
+
+var ErrUnsupportedKey = errors.New(`map key can't be written as a string`)
+
+var ErrNoComma = errors.New(`expected ,`)
+
+var ErrNoValue = errors.New(`expected a value`)
+
+var ErrTrailingData = errors.New(`unexpected data after the value`)
+
+var ErrTooDeep = errors.New(`nested too deeply`)
+
+var ErrClosed = errors.New(`describer is closed`)
+
+// SyntaxError says where in the input a syntax error was found. Err is one of the sentinels above,
+// so errors.Is still works on it
+type SyntaxError struct {
+	Offset  int
+	Line    int
+	Column  int
+	Snippet string
+	Err     error
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at line %d column %d", e.Err, e.Line, e.Column)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// syntaxErrors are the sentinels that mean the input itself is broken, rather than not fitting the type
+var syntaxErrors = map[error]bool{
+	ErrUnexpectedEOF:     true,
+	ErrUnexpectedListEnd: true,
+	ErrUnexpectedMapEnd:  true,
+	ErrNoBracket:         true,
+	ErrNoBrace:           true,
+	ErrNoQuote:           true,
+	ErrNoColon:           true,
+	ErrNoBracketOpen:     true,
+	ErrNoBraceOpen:       true,
+	ErrNoQuoteOpen:       true,
+	ErrNoDigits:          true,
+	ErrNoBool:            true,
+	ErrNoNull:            true,
+	ErrControlCharacter:  true,
+	ErrInvalidEscape:     true,
+	ErrInvalidQuoted:     true,
+	ErrInvalidNumber:     true,
+	ErrNoComma:           true,
+	ErrNoValue:           true,
+	ErrTrailingData:      true,
+	ErrTooDeep:           true,
+}
+
+// snippetSize is how much of the input either side of a syntax error gets quoted with it
+const snippetSize = 16
+
+// newSyntaxError positions err at offset p in b, counting lines and columns from 1
+func newSyntaxError(b []byte, p int, err error) *SyntaxError {
+	if p > len(b) {
+		p = len(b)
+	}
+	if p < 0 {
+		p = 0
+	}
+	line := 1 + bytes.Count(b[:p], []byte{'\n'})
+	column := p + 1
+	if lastLine := bytes.LastIndexByte(b[:p], '\n'); lastLine >= 0 {
+		column = p - lastLine
+	}
+
+	from, to := p-snippetSize, p+snippetSize
+	if from < 0 {
+		from = 0
+	}
+	if to > len(b) {
+		to = len(b)
+	}
+	return &SyntaxError{Offset: p, Line: line, Column: column, Snippet: string(b[from:to]), Err: err}
+}
+
+// PathError says where in the document a value failed to decode, as a path like $.orders[3].items[0].price,
+// along with the Go type that was being filled and the chain of struct fields that led to it
+type PathError struct {
+	Path  string
+	Type  reflect.Type
+	Field string
+	Err   error
+
+	// steps and fields are collected backwards, as the error comes up out of each container
+	steps  []string
+	fields []string
+}
+
+func (e *PathError) Error() string {
+	into := "a value"
+	if e.Type != nil {
+		into = e.Type.String()
+	}
+	if e.Field != "" {
+		into = e.Field + " (" + into + ")"
+	}
+	return e.Path + ", decoding into " + into + ": " + e.Err.Error()
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// atPath adds a step to the path of an error coming up out of a container, starting a PathError for the first one
+func atPath(err error, step string, t reflect.Type, field string) error {
+	if mismatch, ok := err.(*UnmarshalTypeError); ok && mismatch.Type == nil {
+		mismatch.Type = derefType(t)
+	}
+	pe, ok := err.(*PathError)
+	if !ok {
+		pe = &PathError{Type: t, Err: err}
+	}
+	pe.steps = append(pe.steps, step)
+	if field != "" {
+		pe.fields = append(pe.fields, field)
+	}
+	return pe
+}
+
+// finish puts the steps collected on the way up in order
+func (e *PathError) finish() {
+	path := []byte{'$'}
+	for i := len(e.steps) - 1; i >= 0; i-- {
+		path = append(path, e.steps[i]...)
+	}
+	e.Path = string(path)
+
+	fields := make([]string, 0, len(e.fields))
+	for i := len(e.fields) - 1; i >= 0; i-- {
+		fields = append(fields, e.fields[i])
+	}
+	e.Field = strings.Join(fields, ".")
+}
+
+// keyStep is how a key appears in a path, .key if it's a plain word, otherwise ["key"]
+func keyStep(key []byte) string {
+	plain := len(key) > 0
+	for i, c := range key {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return "." + string(key)
+	}
+	return "[" + strconv.Quote(string(key)) + "]"
+}
+
+// indexStep is how an element of a list appears in a path
+func indexStep(i int) string {
+	return "[" + strconv.Itoa(i) + "]"
+}
+
+// rawKey is the text of the quoted key that was just read between p and n, without unescaping it
+func rawKey(b []byte, p, n int) []byte {
+	start := peekValue(b, p, n)
+	if start < n-1 && b[start] == '"' {
+		return b[start+1 : n-1]
+	}
+	return nil
+}
+
+// pathStep is one step into a container, either a key or, if there's no key, an index
+type pathStep struct {
+	key   []byte
+	index int
+	field string
+}
+
+func (s pathStep) String() string {
+	if s.key != nil {
+		return keyStep(s.key)
+	}
+	return indexStep(s.index)
+}
+
+// UnmarshalTypeError is a value that's fine json, but the wrong kind for the Go type it was going into
+type UnmarshalTypeError struct {
+	Value  string
+	Type   reflect.Type
+	Offset int
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	into := "a value"
+	if e.Type != nil {
+		into = e.Type.String()
+	}
+	return fmt.Sprintf("cannot decode a json %s into %s at offset %d", e.Value, into, e.Offset)
+}
+
+// derefType is the type a value really ends up in, through any pointers to it
+func derefType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// UnknownFieldError is a key in an object that doesn't match any field of the struct it's going into
+type UnknownFieldError struct {
+	Key    string
+	Type   reflect.Type
+	Offset int
+	Path   string
+}
+
+func (e *UnknownFieldError) Error() string {
+	return fmt.Sprintf("unknown key %q for %s at %s (offset %d)", e.Key, e.Type, e.Path, e.Offset)
+}
+
+// UnsupportedTypeError is what you get for a type there's no way to decode or write,
+// like a channel, a func or a map keyed by a struct
+type UnsupportedTypeError struct {
+	Type   reflect.Type
+	Reason string
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	if e.Type == nil {
+		return `unsupported type <nil>: ` + e.Reason
+	}
+	return `unsupported type ` + e.Type.String() + `: ` + e.Reason
+}
+
+// UnsupportedValueError is returned by Marshal for a value that can't be written, even though its type can
+type UnsupportedValueError struct {
+	Type   reflect.Type
+	Reason string
+}
+
+func (e *UnsupportedValueError) Error() string {
+	return `unsupported value of type ` + e.Type.String() + `: ` + e.Reason
+}
+
+// MarshalerError is a MarshalJSON or MarshalText method that failed, or a MarshalJSON that wrote something that isn't json
+type MarshalerError struct {
+	Type reflect.Type
+	Err  error
+}
+
+func (e *MarshalerError) Error() string {
+	return `error calling the marshal method of ` + e.Type.String() + `: ` + e.Err.Error()
+}
+
+func (e *MarshalerError) Unwrap() error {
+	return e.Err
+}
+
 var zeroString = reflect.ValueOf("")
 
+var nullBytes = []byte(`null`)
+
+const hexDigits = "0123456789abcdef"
+
+// appendQuoted writes s as a quoted json string, escaping anything json can't carry raw
+func appendQuoted(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i += 1
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			}
+			i += 1
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			// valid json, but javascript treats them as line ends, so encoding/json escapes them too
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
+
 type jsonRawString struct{}
 
 func (j jsonRawString) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
@@ -147,6 +516,10 @@ func (j jsonRawString) IntoPointer(op decodeOperation, p, end int, base unsafe.P
 	return end, ErrNoQuoteOpen
 }
 
+func (j jsonRawString) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	return appendQuoted(b, *(*string)(base)), nil
+}
+
 func (j jsonRawString) ReportPlan(r *jsonReport) {
 	r.Then(`Search for ", returning if I find } or ]`)
 	r.Then(`Search for closing "`)
@@ -172,11 +545,24 @@ func (j jsonEscapedString) IntoPointer(op decodeOperation, p, end int, base unsa
 		if thisChar == '}' {
 			return p, ErrUnexpectedMapEnd
 		}
+		if thisChar == 'n' {
+			return readNull(b, p, end)
+		}
+		if kind := jsonKind(thisChar); kind != "" && kind != "string" {
+			return p, &UnmarshalTypeError{Value: kind, Offset: p}
+		}
 		p += 1
 		if thisChar == '"' {
 			start := p
 			for p < end {
 				thisChar := b[p]
+				if thisChar == '\\' {
+					// no longer a straight copy, so hand over to the slow path
+					return unescapeString(op, start, p, end, base)
+				}
+				if thisChar < 0x20 {
+					return p, ErrControlCharacter
+				}
 				p += 1
 				if thisChar == '"' {
 					if verbose {
@@ -194,12 +580,244 @@ func (j jsonEscapedString) IntoPointer(op decodeOperation, p, end int, base unsa
 	return end, ErrNoQuoteOpen
 }
 
+// unescapeString finishes off a string that started at start, and has just hit its first \\ at p
+func unescapeString(op decodeOperation, start, p, end int, base unsafe.Pointer) (int, error) {
+	b := op.rawData
+	store := op.mode == ModeAlloc
+
+	var out []byte
+	if store {
+		out = make([]byte, p-start, p-start+16)
+		copy(out, b[start:p])
+	}
+
+	for p < end {
+		thisChar := b[p]
+		if thisChar == '"' {
+			if verbose {
+				fmt.Printf("found escaped string in: %#v\n", string(b[start-1:p+1]))
+			}
+			if store {
+				*(*string)(base) = string(out)
+			}
+			return p + 1, nil
+		}
+		if thisChar < 0x20 {
+			return p, ErrControlCharacter
+		}
+		if thisChar != '\\' {
+			if store {
+				out = append(out, thisChar)
+			}
+			p += 1
+			continue
+		}
+
+		escapeStart := p
+		p += 1
+		if p >= end {
+			return end, ErrNoQuote
+		}
+		var unescaped byte
+		switch b[p] {
+		case '"', '\\', '/':
+			unescaped = b[p]
+		case 'b':
+			unescaped = '\b'
+		case 'f':
+			unescaped = '\f'
+		case 'n':
+			unescaped = '\n'
+		case 'r':
+			unescaped = '\r'
+		case 't':
+			unescaped = '\t'
+		case 'u':
+			r, ok := readHex(b, p+1, end)
+			if !ok {
+				return escapeStart, ErrInvalidEscape
+			}
+			p += 5
+			if utf16.IsSurrogate(r) {
+				// the other half has to come straight after, otherwise it's a broken character
+				other, ok := rune(-1), false
+				if p+1 < end && b[p] == '\\' && b[p+1] == 'u' {
+					other, ok = readHex(b, p+2, end)
+				}
+				if decoded := utf16.DecodeRune(r, other); ok && decoded != utf8.RuneError {
+					r = decoded
+					p += 6
+				} else {
+					r = utf8.RuneError
+				}
+			}
+			if store {
+				var encoded [utf8.UTFMax]byte
+				n := utf8.EncodeRune(encoded[:], r)
+				out = append(out, encoded[:n]...)
+			}
+			continue
+		default:
+			return escapeStart, ErrInvalidEscape
+		}
+		if store {
+			out = append(out, unescaped)
+		}
+		p += 1
+	}
+	return end, ErrNoQuote
+}
+
+// readHex reads the four hex digits of a \\u escape
+func readHex(b []byte, p, end int) (rune, bool) {
+	if end-p < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range b[p : p+4] {
+		switch {
+		case c >= '0' && c <= '9':
+			c = c - '0'
+		case c >= 'a' && c <= 'f':
+			c = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r*16 + rune(c)
+	}
+	return r, true
+}
+
+func (j jsonEscapedString) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	return appendQuoted(b, *(*string)(base)), nil
+}
+
 func (j jsonEscapedString) ReportPlan(r *jsonReport) {
-	r.Then(`Search for ", returning if I find } or ]`)
-	r.Then(`Search for closing "`)
+	r.Then(`Search for ", returning if I find } or ], or leaving the base alone if I find null`)
+	r.Then(`Search for closing ", switching to unescaping if I find a \\`)
 	r.Then(`Create a string in the base from the bytes I found`)
 }
 
+// readLiteral checks that a bare word like true starts at p, and isn't just the start of a longer word
+func readLiteral(b []byte, p, end int, literal string) (int, bool) {
+	if end-p < len(literal) || string(b[p:p+len(literal)]) != literal {
+		return p, false
+	}
+	p += len(literal)
+	if p < end {
+		thisChar := b[p]
+		if thisChar >= 'a' && thisChar <= 'z' || thisChar >= 'A' && thisChar <= 'Z' || thisChar >= '0' && thisChar <= '9' || thisChar == '_' {
+			return p, false
+		}
+	}
+	return p, true
+}
+
+// readNull consumes a null starting at p
+func readNull(b []byte, p, end int) (int, error) {
+	n, ok := readLiteral(b, p, end, "null")
+	if !ok {
+		return p, ErrNoNull
+	}
+	if verbose {
+		fmt.Println("found null at", p)
+	}
+	return n, nil
+}
+
+// peekValue skips the whitespace and commas that come before a value, without consuming the value
+func peekValue(b []byte, p, end int) int {
+	for p < end {
+		switch b[p] {
+		case ' ', '\t', '\r', '\n', ',':
+			p += 1
+		default:
+			return p
+		}
+	}
+	return p
+}
+
+// jsonKind names the kind of value that starts with c, or gives "" if no value can start with it
+func jsonKind(c byte) string {
+	switch {
+	case c == '{':
+		return "object"
+	case c == '[':
+		return "array"
+	case c == '"':
+		return "string"
+	case c == 't' || c == 'f':
+		return "bool"
+	case c == '-' || c >= '0' && c <= '9':
+		return "number"
+	}
+	return ""
+}
+
+type jsonBool struct{}
+
+func (j jsonBool) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
+	b := op.rawData
+	if verbose {
+		if op.mode == ModeSkip {
+			fmt.Println(fmt.Sprintf("%T", j), "discarding bool in:", string(b[p:end]))
+		} else {
+			fmt.Println(fmt.Sprintf("%T", j), "consuming bool in:", string(b[p:end]))
+		}
+	}
+	for p < end {
+		thisChar := b[p]
+		if thisChar == ']' {
+			return p, ErrUnexpectedListEnd
+		}
+		if thisChar == '}' {
+			return p, ErrUnexpectedMapEnd
+		}
+		if thisChar == 'n' {
+			return readNull(b, p, end)
+		}
+		if kind := jsonKind(thisChar); kind != "" && kind != "bool" {
+			return p, &UnmarshalTypeError{Value: kind, Offset: p}
+		}
+		if thisChar == 't' || thisChar == 'f' {
+			value := thisChar == 't'
+			literal := "false"
+			if value {
+				literal = "true"
+			}
+			n, ok := readLiteral(b, p, end, literal)
+			if !ok {
+				return p, ErrNoBool
+			}
+			if verbose {
+				fmt.Println("found bool", string(b[p:n]))
+			}
+			if op.mode == ModeAlloc {
+				*(*bool)(base) = value
+			}
+			return n, nil
+		}
+		p += 1
+	}
+	return end, ErrNoBool
+}
+
+func (j jsonBool) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	if *(*bool)(base) {
+		return append(b, "true"...), nil
+	}
+	return append(b, "false"...), nil
+}
+
+func (j jsonBool) ReportPlan(r *jsonReport) {
+	r.Then(`Search for t or f, returning if I find } or ], or leaving the base alone if I find null`)
+	r.Then(`Check for the rest of true or false`)
+	r.Then(`Write the bool into the base`)
+}
+
 type jsonArray struct {
 	sliceType    reflect.Type
 	internalProc jsonStoredProcedure
@@ -215,12 +833,17 @@ func newJsonArray(t reflect.Type, d describer) *jsonArray {
 	switch e.Kind() {
 	case reflect.String:
 		j.cache = 's'
+	case reflect.Uint8:
+		pe := reflect.PtrTo(e)
+		if !pe.Implements(marshalerType) && !pe.Implements(textMarshalerType) {
+			j.cache = 'b'
+		}
 	}
 	return j
 }
 
 func (j jsonArray) ReportPlan(r *jsonReport) {
-	r.Then(`Search for [, returning if I find } or ]`)
+	r.Then(`Search for [, returning if I find } or ], or setting the slice to nil if I find null`)
 	r.Then(`Repeatedly...`)
 	child := r.Deeper()
 
@@ -248,6 +871,7 @@ func (j jsonArray) IntoPointer(op decodeOperation, p, end int, base unsafe.Point
 	l := 0
 	var pointers []byte
 	posInPointers := 0
+	items := 0
 
 	for p < end {
 		thisChar := b[p]
@@ -257,6 +881,20 @@ func (j jsonArray) IntoPointer(op decodeOperation, p, end int, base unsafe.Point
 		if thisChar == '}' {
 			return p, ErrUnexpectedMapEnd
 		}
+		if thisChar == 'n' {
+			n, err := readNull(b, p, end)
+			if err == nil && store {
+				currSlice := reflect.Indirect(reflect.NewAt(j.sliceType, base))
+				currSlice.Set(reflect.Zero(j.sliceType))
+			}
+			return n, err
+		}
+		if thisChar == '"' && j.cache == 'b' {
+			return j.intoBytes(op, p, end, base)
+		}
+		if kind := jsonKind(thisChar); kind != "" && kind != "array" {
+			return p, &UnmarshalTypeError{Value: kind, Offset: p}
+		}
 		p += 1
 		if thisChar == '[' {
 			start := p - 1
@@ -337,15 +975,24 @@ func (j jsonArray) IntoPointer(op decodeOperation, p, end int, base unsafe.Point
 					newPtr = unsafe.Pointer(&pointers[posInPointers-itemSize])
 				}
 
+				op.enter(pathStep{index: items})
 				n, err := j.internalProc.IntoPointer(op, p-1, end, newPtr)
+				if err != nil && err != ErrUnexpectedListEnd {
+					n, err = op.carryOn(n, end, err, j.internalType)
+				}
+				op.leave()
 				if err != nil {
 					if err != ErrUnexpectedListEnd {
-						return n, err
+						return n, atPath(err, indexStep(items), j.internalType, "")
 					}
 					posInPointers -= itemSize
+				} else {
+					items += 1
 				}
 				p = n
-				goto anotherItem
+				if p < end {
+					goto anotherItem
+				}
 			}
 			return end, ErrNoBracket
 		}
@@ -353,26 +1000,443 @@ func (j jsonArray) IntoPointer(op decodeOperation, p, end int, base unsafe.Point
 	return end, ErrNoBracketOpen
 }
 
-type jsonMaybeNull struct {
-	ptrType           reflect.Type
-	underlyingType    reflect.Type
-	underlyingHandler jsonStoredProcedure
+// intoBytes reads a base64 string into a []byte, the way encoding/json writes them
+func (j jsonArray) intoBytes(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
+	var s string
+	n, err := jsonEscapedString{}.IntoPointer(op, p, end, unsafe.Pointer(&s))
+	if err != nil || op.mode == ModeSkip {
+		return n, err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return p, err
+	}
+	if verbose {
+		fmt.Println(fmt.Sprintf("%T", j), "decoded", len(decoded), "bytes from base64")
+	}
+	currSlice := reflect.Indirect(reflect.NewAt(j.sliceType, base))
+	currSlice.SetBytes(decoded)
+	return n, nil
 }
 
-func (j jsonMaybeNull) String() string {
-	return fmt.Sprintf(`space-maker for %s`, j.ptrType.String())
+func (j jsonArray) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	s := (*reflect.SliceHeader)(base)
+	if s.Data == 0 {
+		return append(b, nullBytes...), nil
+	}
+
+	if j.cache == 'b' {
+		raw := unsafe.Slice((*byte)(unsafe.Pointer(s.Data)), s.Len)
+		b = append(b, '"')
+		b = append(b, base64.StdEncoding.EncodeToString(raw)...)
+		return append(b, '"'), nil
+	}
+
+	step := encodeStep{ptr: s.Data, length: s.Len}
+	if err := e.enter(step, j.sliceType); err != nil {
+		return b, err
+	}
+	defer e.leave(step)
+
+	itemSize := j.internalType.Size()
+	data := unsafe.Pointer(s.Data)
+
+	b = append(b, '[')
+	for i := 0; i < s.Len; i++ {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		var err error
+		b, err = j.internalProc.FromPointer(e, b, unsafe.Pointer(uintptr(data)+uintptr(i)*itemSize))
+		if err != nil {
+			return b, err
+		}
+	}
+	return append(b, ']'), nil
 }
 
-func (j jsonMaybeNull) ReportPlan(r *jsonReport) {
-	r.Then(`Check to see if I have a nil %s`, j.ptrType)
+type jsonFixedArray struct {
+	arrayType    reflect.Type
+	internalProc jsonStoredProcedure
+	internalType reflect.Type
+	length       int
+	skipper      jsonStoredProcedure
+}
+
+func newJsonFixedArray(t reflect.Type, d describer) *jsonFixedArray {
+	e := t.Elem()
+	return &jsonFixedArray{arrayType: t, internalProc: d.Describe(e), internalType: e, length: t.Len(),
+		skipper: d.Describe(interfaceType)}
+}
+
+func (j jsonFixedArray) ReportPlan(r *jsonReport) {
+	r.Then(`Search for [, returning if I find } or ], or leaving the %s alone if I find null`, j.arrayType)
+	r.Then(`Repeatedly, straight into the next of the %d places in the array...`, j.length)
 	func() {
 		defer r.Deeper()()
-		r.Then(`If so, create a %s`, j.underlyingType)
+		j.internalProc.ReportPlan(r)
 	}()
-	j.underlyingHandler.ReportPlan(r)
+	r.Then(`Skip anything past the end of the array, and zero any places I didn't get to`)
 }
 
-func newMaybeNull(t reflect.Type, d describer) *jsonMaybeNull {
+func (j jsonFixedArray) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
+	b := op.rawData
+	if verbose {
+		if op.mode == ModeSkip {
+			fmt.Println(fmt.Sprintf("%T", j), "discarding array in", string(b[p:end]))
+		} else {
+			fmt.Println(fmt.Sprintf("%T", j), "consuming array in", string(b[p:end]))
+		}
+	}
+
+	store := op.mode == ModeAlloc
+	itemSize := j.internalType.Size()
+
+	for p < end {
+		thisChar := b[p]
+		if thisChar == ']' {
+			return p, ErrUnexpectedListEnd
+		}
+		if thisChar == '}' {
+			return p, ErrUnexpectedMapEnd
+		}
+		if thisChar == 'n' {
+			return readNull(b, p, end)
+		}
+		if kind := jsonKind(thisChar); kind != "" && kind != "array" {
+			return p, &UnmarshalTypeError{Value: kind, Offset: p}
+		}
+		p += 1
+		if thisChar == '[' {
+			start := p - 1
+			i := 0
+			for p < end {
+				thisChar := b[p]
+				p += 1
+
+				if thisChar == ']' {
+					if store && i < j.length {
+						arr := reflect.Indirect(reflect.NewAt(j.arrayType, base))
+						zero := reflect.Zero(j.internalType)
+						for ; i < j.length; i++ {
+							arr.Index(i).Set(zero)
+						}
+					}
+					if verbose {
+						fmt.Println("found array", string(b[start:p]))
+					}
+					return p, nil
+				}
+
+				// elements go straight into their place, and any that don't fit are skipped whatever they are
+				itemOp := op
+				itemPtr := unrealPointer
+				itemProc := j.internalProc
+				if i >= j.length {
+					itemProc = j.skipper
+					itemOp.mode = ModeSkip
+				} else if store {
+					itemPtr = unsafe.Pointer(uintptr(base) + uintptr(i)*itemSize)
+				} else {
+					itemOp.mode = ModeSkip
+				}
+
+				op.enter(pathStep{index: i})
+				n, err := itemProc.IntoPointer(itemOp, p-1, end, itemPtr)
+				if err != nil && err != ErrUnexpectedListEnd {
+					n, err = itemOp.carryOn(n, end, err, j.internalType)
+				}
+				op.leave()
+				if err != nil {
+					if err != ErrUnexpectedListEnd {
+						return n, atPath(err, indexStep(i), j.internalType, "")
+					}
+				} else {
+					i += 1
+				}
+				p = n
+			}
+			return end, ErrNoBracket
+		}
+	}
+	return end, ErrNoBracketOpen
+}
+
+func (j jsonFixedArray) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	itemSize := j.internalType.Size()
+
+	b = append(b, '[')
+	for i := 0; i < j.length; i++ {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		var err error
+		b, err = j.internalProc.FromPointer(e, b, unsafe.Pointer(uintptr(base)+uintptr(i)*itemSize))
+		if err != nil {
+			return b, err
+		}
+	}
+	return append(b, ']'), nil
+}
+
+// jsonQuoted is for values that have been written inside a string, like the ",string" tag option asks for
+type jsonQuoted struct {
+	inner jsonStoredProcedure
+}
+
+// newJsonQuoted wraps the handler for t so it expects quotes, or returns nil if t can't be quoted
+func newJsonQuoted(t reflect.Type, des describer) jsonStoredProcedure {
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return &jsonQuoted{inner: des.Describe(t)}
+	case reflect.Ptr:
+		if t.Name() != "" {
+			return nil
+		}
+		underlying := newJsonQuoted(t.Elem(), des)
+		if underlying == nil {
+			return nil
+		}
+		return &jsonMaybeNull{ptrType: t, underlyingType: t.Elem(), underlyingHandler: underlying}
+	}
+	return nil
+}
+
+func (j jsonQuoted) ReportPlan(r *jsonReport) {
+	r.Then(`Search for ", returning if I find } or ], or handing a null straight over`)
+	r.Then(`Find the closing ", then inside the quotes:`)
+	func() {
+		defer r.Deeper()()
+		j.inner.ReportPlan(r)
+	}()
+	r.Then(`Check there was nothing else inside the quotes`)
+}
+
+func (j jsonQuoted) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
+	b := op.rawData
+	if verbose {
+		if op.mode == ModeSkip {
+			fmt.Println(fmt.Sprintf("%T", j), "discarding quoted value in:", string(b[p:end]))
+		} else {
+			fmt.Println(fmt.Sprintf("%T", j), "consuming quoted value in:", string(b[p:end]))
+		}
+	}
+
+	for p < end {
+		thisChar := b[p]
+		if thisChar == ']' {
+			return p, ErrUnexpectedListEnd
+		}
+		if thisChar == '}' {
+			return p, ErrUnexpectedMapEnd
+		}
+		if thisChar == 'n' {
+			return j.inner.IntoPointer(op, p, end, base)
+		}
+		if kind := jsonKind(thisChar); kind != "" && kind != "string" {
+			return p, &UnmarshalTypeError{Value: kind, Offset: p}
+		}
+		p += 1
+		if thisChar == '"' {
+			start := p
+			for p < end && b[p] != '"' {
+				p += 1
+			}
+			if p == end {
+				return end, ErrNoQuote
+			}
+
+			// the value has to fill the quotes exactly, so the inner handler only gets to see what's inside
+			if start == p || peekValue(b, start, p) != start {
+				return start, ErrInvalidQuoted
+			}
+			n, err := j.inner.IntoPointer(op, start, p, base)
+			if err != nil {
+				return n, err
+			}
+			if n != p {
+				return n, ErrInvalidQuoted
+			}
+			if verbose {
+				fmt.Println("found quoted value", string(b[start-1:p+1]))
+			}
+			return p + 1, nil
+		}
+	}
+	return end, ErrNoQuoteOpen
+}
+
+func (j jsonQuoted) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	b = append(b, '"')
+	b, err := j.inner.FromPointer(e, b, base)
+	if err != nil {
+		return b, err
+	}
+	return append(b, '"'), nil
+}
+
+// jsonCustom hands values over to the methods a type has for decoding and writing itself,
+// falling back to the normal plan for whichever direction it doesn't handle
+type jsonCustom struct {
+	customType      reflect.Type
+	unmarshaler     bool
+	textUnmarshaler bool
+	marshaler       bool
+	textMarshaler   bool
+	fallback        jsonStoredProcedure
+	skipper         jsonStoredProcedure
+}
+
+// newJsonCustom returns nil if t has no methods of its own for json or text
+func newJsonCustom(t reflect.Type, d *FastDescribers) *jsonCustom {
+	if t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface {
+		return nil
+	}
+	ptr := reflect.PtrTo(t)
+	j := &jsonCustom{
+		customType:      t,
+		unmarshaler:     ptr.Implements(unmarshalerType),
+		textUnmarshaler: ptr.Implements(textUnmarshalerType),
+		marshaler:       ptr.Implements(marshalerType),
+		textMarshaler:   ptr.Implements(textMarshalerType),
+	}
+	decodes := j.unmarshaler || j.textUnmarshaler
+	encodes := j.marshaler || j.textMarshaler
+	if !decodes && !encodes {
+		return nil
+	}
+	if !decodes || !encodes {
+		j.fallback = d.learnKind(t)
+	}
+	j.skipper = d.Describe(interfaceType)
+	return j
+}
+
+func (j jsonCustom) ReportPlan(r *jsonReport) {
+	switch {
+	case j.unmarshaler:
+		r.Then(`Search for the start of a value, returning if I find } or ]`)
+		r.Then(`Skip to the end of the value, and hand all of its bytes to (*%s).UnmarshalJSON`, j.customType)
+	case j.textUnmarshaler:
+		r.Then(`Search for ", returning if I find } or ], or leaving the base alone if I find null`)
+		r.Then(`Read the string, and hand its text to (*%s).UnmarshalText`, j.customType)
+	default:
+		j.fallback.ReportPlan(r)
+	}
+}
+
+func (j jsonCustom) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
+	if !j.unmarshaler && !j.textUnmarshaler {
+		return j.fallback.IntoPointer(op, p, end, base)
+	}
+
+	b := op.rawData
+	if verbose {
+		if op.mode == ModeSkip {
+			fmt.Println(fmt.Sprintf("%T", j), "discarding", j.customType.String(), "in", string(b[p:end]))
+		} else {
+			fmt.Println(fmt.Sprintf("%T", j), "consuming", j.customType.String(), "in", string(b[p:end]))
+		}
+	}
+
+	start := peekValue(b, p, end)
+	if start == end {
+		return end, ErrUnexpectedEOF
+	}
+	switch b[start] {
+	case ']':
+		return start, ErrUnexpectedListEnd
+	case '}':
+		return start, ErrUnexpectedMapEnd
+	}
+
+	if j.unmarshaler {
+		skipOp := op
+		skipOp.mode = ModeSkip
+		n, err := j.skipper.IntoPointer(skipOp, start, end, unrealPointer)
+		if err != nil {
+			return n, err
+		}
+		if op.mode == ModeAlloc {
+			if verbose {
+				fmt.Println("handing over", string(b[start:n]))
+			}
+			if err := reflect.NewAt(j.customType, base).Interface().(Unmarshaler).UnmarshalJSON(b[start:n]); err != nil {
+				return start, err
+			}
+		}
+		return n, nil
+	}
+
+	if b[start] == 'n' {
+		return readNull(b, start, end)
+	}
+	if kind := jsonKind(b[start]); kind != "" && kind != "string" {
+		return start, &UnmarshalTypeError{Value: kind, Offset: start}
+	}
+	if b[start] != '"' {
+		return start, ErrNoQuoteOpen
+	}
+	var text string
+	n, err := jsonEscapedString{}.IntoPointer(op, start, end, unsafe.Pointer(&text))
+	if err != nil {
+		return n, err
+	}
+	if op.mode == ModeAlloc {
+		if err := reflect.NewAt(j.customType, base).Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+			return start, err
+		}
+	}
+	return n, nil
+}
+
+func (j jsonCustom) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	switch {
+	case j.marshaler:
+		out, err := reflect.NewAt(j.customType, base).Interface().(Marshaler).MarshalJSON()
+		if err != nil {
+			return b, &MarshalerError{Type: j.customType, Err: err}
+		}
+		// it goes into the output as it is, so it had better be exactly one json value
+		if n, err := scanDocument(out); err != nil {
+			return b, &MarshalerError{Type: j.customType, Err: newSyntaxError(out, n, err)}
+		}
+		return append(b, out...), nil
+	case j.textMarshaler:
+		out, err := reflect.NewAt(j.customType, base).Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return b, &MarshalerError{Type: j.customType, Err: err}
+		}
+		return appendQuoted(b, string(out)), nil
+	default:
+		return j.fallback.FromPointer(e, b, base)
+	}
+}
+
+type jsonMaybeNull struct {
+	ptrType           reflect.Type
+	underlyingType    reflect.Type
+	underlyingHandler jsonStoredProcedure
+}
+
+func (j jsonMaybeNull) String() string {
+	return fmt.Sprintf(`space-maker for %s`, j.ptrType.String())
+}
+
+func (j jsonMaybeNull) ReportPlan(r *jsonReport) {
+	r.Then(`If I get a null, set the %s to nil`, j.ptrType)
+	r.Then(`Otherwise check to see if I have a nil %s`, j.ptrType)
+	func() {
+		defer r.Deeper()()
+		r.Then(`If so, create a %s`, j.underlyingType)
+	}()
+	j.underlyingHandler.ReportPlan(r)
+}
+
+func newMaybeNull(t reflect.Type, d describer) *jsonMaybeNull {
 	underT := t.Elem()
 	return &jsonMaybeNull{
 		ptrType:           t,
@@ -390,6 +1454,15 @@ func (j jsonMaybeNull) IntoPointer(op decodeOperation, p, end int, base unsafe.P
 	// *T has to be initialized if it's not already, and point to a valid T space
 	curPtr := reflect.Indirect(reflect.NewAt(j.ptrType, base))
 
+	// unless the json says there's nothing there
+	if start := peekValue(op.rawData, p, end); start < end && op.rawData[start] == 'n' {
+		n, err := readNull(op.rawData, start, end)
+		if err == nil {
+			curPtr.Set(reflect.Zero(j.ptrType))
+		}
+		return n, err
+	}
+
 	var maybe2 string
 
 	if verbose {
@@ -415,24 +1488,54 @@ func (j jsonMaybeNull) IntoPointer(op decodeOperation, p, end int, base unsafe.P
 	return n, err
 }
 
+func (j jsonMaybeNull) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	// base is a **T, which might be holding a nil
+	ptr := *(*unsafe.Pointer)(base)
+	if ptr == nil {
+		return append(b, nullBytes...), nil
+	}
+	step := encodeStep{ptr: uintptr(ptr)}
+	if err := e.enter(step, j.ptrType); err != nil {
+		return b, err
+	}
+	b, err := j.underlyingHandler.FromPointer(e, b, ptr)
+	e.leave(step)
+	return b, err
+}
+
 type jsonInspect struct {
 	mapHandler    jsonStoredProcedure
 	listHandler   jsonStoredProcedure
 	stringHandler jsonStoredProcedure
+	boolHandler   jsonStoredProcedure
+	numberHandler jsonStoredProcedure
+	describer     describer
+	useNumber     bool
 }
 
-func newJsonInspect() *jsonInspect {
+func newJsonInspect(useNumber bool) *jsonInspect {
 	if verbose {
 		fmt.Println("called newJsonInspect")
 	}
-	j := &jsonInspect{}
+	j := &jsonInspect{useNumber: useNumber}
 	return j
 }
 
 func (j jsonInspect) ReportPlan(r *jsonReport) {
-	r.Then(`If I get a {, I'll pass it off as a map[string]interface{}`)
-	r.Then(`If I get a [, I'll pass it off as a []interface{}`)
-	r.Then(`If I get a ", I'll pass it off as a string`)
+	r.Then(`Search for the start of a value, returning if I find } or ], then:`)
+	func() {
+		defer r.Deeper()()
+		r.Then(`If I get a {, I'll pass it off as a map[string]interface{}`)
+		r.Then(`If I get a [, I'll pass it off as a []interface{}`)
+		r.Then(`If I get a ", I'll pass it off as a string`)
+		if j.useNumber {
+			r.Then(`If I get a digit or -, I'll keep the text of it as a Number`)
+		} else {
+			r.Then(`If I get a digit or -, I'll pass it off as a float64`)
+		}
+		r.Then(`If I get a t or f, I'll pass it off as a bool`)
+		r.Then(`If I get a null, I'll use a nil interface{}`)
+	}()
 	r.Then(`I'll dereference the result into the interface{} in the base pointer`)
 }
 
@@ -440,6 +1543,13 @@ func (j *jsonInspect) Setup(d describer) {
 	j.mapHandler = d.Describe(reflect.TypeOf(make(map[string]interface{})))
 	j.listHandler = d.Describe(reflect.TypeOf(make([]interface{}, 0)))
 	j.stringHandler = jsonEscapedString{}
+	j.boolHandler = jsonBool{}
+	if j.useNumber {
+		j.numberHandler = jsonNumberText{}
+	} else {
+		j.numberHandler = jsonFloat{bits: 64}
+	}
+	j.describer = d
 }
 
 func (j jsonInspect) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
@@ -517,21 +1627,102 @@ func (j jsonInspect) IntoPointer(op decodeOperation, p, end int, base unsafe.Poi
 			*asP = l
 			return n, nil
 		}
+		if thisChar == 'n' {
+			n, err := readNull(b, p-1, end)
+			if err == nil && op.mode == ModeAlloc {
+				*asP = nil
+			}
+			return n, err
+		}
+		if thisChar == 't' || thisChar == 'f' {
+			if op.mode == ModeSkip {
+				return j.boolHandler.IntoPointer(op, p-1, end, unrealPointer)
+			}
+			var l bool
+			ptr := unsafe.Pointer(&l)
+			n, err := j.boolHandler.IntoPointer(op, p-1, end, ptr)
+			if err != nil {
+				return n, err
+			}
+
+			if verbose {
+				fmt.Println("inspected bool at", string(b[p-1:n]))
+			}
+
+			*asP = l
+			return n, nil
+		}
+		if thisChar == '-' || (thisChar >= '0' && thisChar <= '9') {
+			if op.mode == ModeSkip {
+				return j.numberHandler.IntoPointer(op, p-1, end, unrealPointer)
+			}
+			if j.useNumber {
+				var l Number
+				n, err := j.numberHandler.IntoPointer(op, p-1, end, unsafe.Pointer(&l))
+				if err != nil {
+					return n, err
+				}
+				*asP = l
+				return n, nil
+			}
+			var l float64
+			ptr := unsafe.Pointer(&l)
+			n, err := j.numberHandler.IntoPointer(op, p-1, end, ptr)
+			if err != nil {
+				return n, err
+			}
+
+			if verbose {
+				fmt.Println("inspected number at", string(b[p-1:n]))
+			}
+
+			*asP = l
+			return n, nil
+		}
+	}
+	return end, ErrUnexpectedEOF
+}
+
+func (j jsonInspect) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	switch v := (*(*interface{})(base)).(type) {
+	case nil:
+		return append(b, nullBytes...), nil
+	case string:
+		return appendQuoted(b, v), nil
+	case bool:
+		return j.boolHandler.FromPointer(e, b, unsafe.Pointer(&v))
+	case float64:
+		return jsonFloat{bits: 64}.FromPointer(e, b, unsafe.Pointer(&v))
+	case Number:
+		return jsonNumberText{}.FromPointer(e, b, unsafe.Pointer(&v))
+	case map[string]interface{}:
+		return j.mapHandler.FromPointer(e, b, unsafe.Pointer(&v))
+	case []interface{}:
+		return j.listHandler.FromPointer(e, b, unsafe.Pointer(&v))
+	default:
+		// anything else gets a plan of its own, run against a copy of the value
+		val := reflect.ValueOf(v)
+		if verbose {
+			fmt.Println("inspecting a", val.Type().String(), "to write it out")
+		}
+		copied := reflect.New(val.Type())
+		reflect.Indirect(copied).Set(val)
+		return j.describer.Describe(val.Type()).FromPointer(e, b, unsafe.Pointer(copied.Pointer()))
 	}
-	return 0, ErrUnexpectedEOF
 }
 
 type jsonStringMap struct{}
 
 func (j jsonStringMap) ReportPlan(r *jsonReport) {
-	r.Then(`Look for a {, create a map[string]string, then repeatedly:`)
+	r.Then(`If I get a null, set the map[string]string to nil`)
+	r.Then(`Otherwise look for a {, create a map[string]string, then repeatedly:`)
 	func() {
 		defer r.Deeper()()
 
 		func() {
 			r.Then("To get a key, I'll:")
 			defer r.Deeper()()
-			jsonRawString{}.ReportPlan(r)
+			jsonEscapedString{}.ReportPlan(r)
 		}()
 		func() {
 			r.Then("To get a value, I'll:")
@@ -559,94 +1750,836 @@ func (j jsonStringMap) IntoPointer(op decodeOperation, p, end int, base unsafe.P
 	var lStr, rStr string
 	var lPtr, rPtr unsafe.Pointer
 	if store {
-		currentMap := (*map[string]string)(base)
-		if *currentMap == nil {
-			*currentMap = make(map[string]string, defaultMapSize)
-		}
-		cMap = *currentMap
 		lPtr, rPtr = unsafe.Pointer(&lStr), unsafe.Pointer(&rStr)
 	}
 
 	for p < end {
 		thisChar := b[p]
-
+
+		if thisChar == ']' {
+			return p, ErrUnexpectedListEnd
+		}
+		if thisChar == '}' {
+			return p, ErrUnexpectedMapEnd
+		}
+		if thisChar == 'n' {
+			n, err := readNull(b, p, end)
+			if err == nil && store {
+				*(*map[string]string)(base) = nil
+			}
+			return n, err
+		}
+
+		if kind := jsonKind(thisChar); kind != "" && kind != "object" {
+			return p, &UnmarshalTypeError{Value: kind, Offset: p}
+		}
+		p += 1
+		if thisChar == '{' {
+			if store {
+				currentMap := (*map[string]string)(base)
+				if *currentMap == nil {
+					*currentMap = make(map[string]string, defaultMapSize)
+				}
+				cMap = *currentMap
+			}
+			mapStart := p - 1
+			for p < end {
+			anotherKey:
+				n, err := jsonEscapedString{}.IntoPointer(op, p, end, lPtr)
+				if err != nil {
+					if err != ErrUnexpectedMapEnd {
+						return n, err
+					}
+					if verbose {
+						fmt.Println("found map:", string(b[mapStart:n+1]))
+					}
+					return n + 1, nil
+				}
+
+				key := rawKey(b, p, n)
+				p = n
+				keyEnd := p
+				for p < end {
+					thisChar := b[p]
+					p += 1
+					if thisChar == ':' {
+						op.enter(pathStep{key: key})
+						n, err := jsonEscapedString{}.IntoPointer(op, p, end, rPtr)
+						if err != nil {
+							n, err = op.carryOn(n, end, err, zeroString.Type())
+							op.leave()
+							if err != nil {
+								return n, atPath(err, keyStep(key), zeroString.Type(), "")
+							}
+							// skipped, but the key still gets a value like in encoding/json
+							if store {
+								cMap[lStr] = ""
+							}
+							p = n
+							goto anotherKey
+						}
+						op.leave()
+						p = n
+						if store {
+							cMap[lStr] = rStr
+						}
+						goto anotherKey
+					}
+				}
+				return keyEnd, ErrNoColon
+			}
+			return end, ErrNoBrace
+		}
+	}
+	return end, ErrNoBrace
+}
+
+func (j jsonStringMap) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	m := *(*map[string]string)(base)
+	if m == nil {
+		return append(b, nullBytes...), nil
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b = append(b, '{')
+	for i, k := range keys {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendQuoted(b, k)
+		b = append(b, ':')
+		b = appendQuoted(b, m[k])
+	}
+	return append(b, '}'), nil
+}
+
+type jsonNumber struct {
+	bits   int
+	signed bool
+}
+
+func newJsonNumber(r reflect.Type, des describer, signed bool, bits int) jsonNumber {
+	return jsonNumber{bits: bits, signed: signed}
+}
+
+func (j jsonNumber) ReportPlan(r *jsonReport) {
+	r.Then(`Search for a digit or -, returning if I find } or ], or leaving the base alone if I find null`)
+	if j.signed {
+		r.Then(`Read the digits as a %d bit signed integer, failing if it overflows`, j.bits)
+	} else {
+		r.Then(`Read the digits as a %d bit unsigned integer, failing if it overflows`, j.bits)
+	}
+	r.Then(`Write the integer into the base`)
+}
+
+func (j jsonNumber) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
+	b := op.rawData
+	if verbose {
+		if op.mode == ModeSkip {
+			fmt.Println(fmt.Sprintf("%T", j), "discarding int in:", string(b[p:end]))
+		} else {
+			fmt.Println(fmt.Sprintf("%T", j), "consuming int in:", string(b[p:end]))
+		}
+	}
+
+	for p < end {
+		thisChar := b[p]
+		if thisChar == ']' {
+			return p, ErrUnexpectedListEnd
+		}
+		if thisChar == '}' {
+			return p, ErrUnexpectedMapEnd
+		}
+		if thisChar == 'n' {
+			return readNull(b, p, end)
+		}
+		if kind := jsonKind(thisChar); kind != "" && kind != "number" {
+			return p, &UnmarshalTypeError{Value: kind, Offset: p}
+		}
+		if thisChar == '-' || (thisChar >= '0' && thisChar <= '9') {
+			start := p
+			negative := thisChar == '-'
+			if negative {
+				p += 1
+			}
+
+			var n uint64
+			overflow := false
+			digitsStart := p
+			for p < end {
+				thisChar := b[p]
+				if thisChar < '0' || thisChar > '9' {
+					break
+				}
+				d := uint64(thisChar - '0')
+				if n > (maxUint64-d)/10 {
+					overflow = true
+				}
+				n = n*10 + d
+				p += 1
+			}
+			if p == digitsStart {
+				return p, ErrNoDigits
+			}
+			if p < end && (b[p] == '.' || b[p] == 'e' || b[p] == 'E') {
+				// fine json, just not a whole number, so it's a mismatch as long as the rest of it is there
+				n, err := scanNumber(b, start, end)
+				if err != nil {
+					return n, err
+				}
+				return start, &UnmarshalTypeError{Value: "number " + string(b[start:n]), Offset: start}
+			}
+
+			if verbose {
+				fmt.Println("found int", string(b[start:p]))
+			}
+
+			if overflow || !j.fits(n, negative) {
+				return start, &UnmarshalTypeError{Value: "number " + string(b[start:p]), Offset: start}
+			}
+			if op.mode == ModeAlloc {
+				j.write(base, n, negative)
+			}
+			return p, nil
+		}
+		p += 1
+	}
+
+	return end, ErrUnexpectedEOF
+}
+
+const maxUint64 = ^uint64(0)
+
+// fits reports whether the magnitude n (negated if negative) is in range for this integer
+func (j jsonNumber) fits(n uint64, negative bool) bool {
+	if !j.signed {
+		if negative {
+			return n == 0
+		}
+		return j.bits == 64 || n < uint64(1)<<uint(j.bits)
+	}
+	limit := uint64(1) << uint(j.bits-1)
+	if negative {
+		return n <= limit
+	}
+	return n < limit
+}
+
+// write stores the magnitude n at the width of this integer, negating it if needed
+func (j jsonNumber) write(base unsafe.Pointer, n uint64, negative bool) {
+	if negative {
+		n = -n
+	}
+	switch j.bits {
+	case 8:
+		*(*uint8)(base) = uint8(n)
+	case 16:
+		*(*uint16)(base) = uint16(n)
+	case 32:
+		*(*uint32)(base) = uint32(n)
+	default:
+		*(*uint64)(base) = n
+	}
+}
+
+func (j jsonNumber) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	if j.signed {
+		switch j.bits {
+		case 8:
+			return strconv.AppendInt(b, int64(*(*int8)(base)), 10), nil
+		case 16:
+			return strconv.AppendInt(b, int64(*(*int16)(base)), 10), nil
+		case 32:
+			return strconv.AppendInt(b, int64(*(*int32)(base)), 10), nil
+		default:
+			return strconv.AppendInt(b, *(*int64)(base), 10), nil
+		}
+	}
+	switch j.bits {
+	case 8:
+		return strconv.AppendUint(b, uint64(*(*uint8)(base)), 10), nil
+	case 16:
+		return strconv.AppendUint(b, uint64(*(*uint16)(base)), 10), nil
+	case 32:
+		return strconv.AppendUint(b, uint64(*(*uint32)(base)), 10), nil
+	default:
+		return strconv.AppendUint(b, *(*uint64)(base), 10), nil
+	}
+}
+
+// scanNumber finds the end of the number literal that starts at p
+func scanNumber(b []byte, p, end int) (int, error) {
+	if p < end && b[p] == '-' {
+		p += 1
+	}
+	digitsStart := p
+	for p < end && b[p] >= '0' && b[p] <= '9' {
+		p += 1
+	}
+	if p == digitsStart {
+		return p, ErrNoDigits
+	}
+	if p < end && b[p] == '.' {
+		p += 1
+		fracStart := p
+		for p < end && b[p] >= '0' && b[p] <= '9' {
+			p += 1
+		}
+		if p == fracStart {
+			return p, ErrNoDigits
+		}
+	}
+	if p < end && (b[p] == 'e' || b[p] == 'E') {
+		p += 1
+		if p < end && (b[p] == '+' || b[p] == '-') {
+			p += 1
+		}
+		expStart := p
+		for p < end && b[p] >= '0' && b[p] <= '9' {
+			p += 1
+		}
+		if p == expStart {
+			return p, ErrNoDigits
+		}
+	}
+	return p, nil
+}
+
+// Number is a json number kept as the text it was written with, so that nothing is lost
+// by turning it into a float64 before you know what it's meant to be
+type Number string
+
+func (n Number) String() string {
+	return string(n)
+}
+
+func (n Number) Float64() (float64, error) {
+	return strconv.ParseFloat(string(n), 64)
+}
+
+func (n Number) Int64() (int64, error) {
+	return strconv.ParseInt(string(n), 10, 64)
+}
+
+var typeOfNumber = reflect.TypeOf(Number(""))
+
+type jsonNumberText struct{}
+
+func (j jsonNumberText) ReportPlan(r *jsonReport) {
+	r.Then(`Search for a digit or -, returning if I find } or ], or leaving the base alone if I find null`)
+	r.Then(`Find the end of the number, checking it's a real one`)
+	r.Then(`Create a Number in the base from the bytes I found`)
+}
+
+func (j jsonNumberText) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
+	b := op.rawData
+	if verbose {
+		if op.mode == ModeSkip {
+			fmt.Println(fmt.Sprintf("%T", j), "discarding number in:", string(b[p:end]))
+		} else {
+			fmt.Println(fmt.Sprintf("%T", j), "consuming number in:", string(b[p:end]))
+		}
+	}
+
+	for p < end {
+		thisChar := b[p]
+		if thisChar == ']' {
+			return p, ErrUnexpectedListEnd
+		}
+		if thisChar == '}' {
+			return p, ErrUnexpectedMapEnd
+		}
+		if thisChar == 'n' {
+			return readNull(b, p, end)
+		}
+		if kind := jsonKind(thisChar); kind != "" && kind != "number" {
+			return p, &UnmarshalTypeError{Value: kind, Offset: p}
+		}
+		if thisChar == '-' || (thisChar >= '0' && thisChar <= '9') {
+			n, err := scanNumber(b, p, end)
+			if err != nil {
+				return n, err
+			}
+			if verbose {
+				fmt.Println("found number", string(b[p:n]))
+			}
+			if op.mode == ModeAlloc {
+				*(*Number)(base) = Number(b[p:n])
+			}
+			return n, nil
+		}
+		p += 1
+	}
+
+	return end, ErrUnexpectedEOF
+}
+
+func (j jsonNumberText) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	n := *(*Number)(base)
+	if n == "" {
+		return append(b, '0'), nil
+	}
+	if end, err := scanNumber([]byte(n), 0, len(n)); err != nil || end != len(n) {
+		return b, ErrInvalidNumber
+	}
+	return append(b, n...), nil
+}
+
+// RawMessage is a json value kept exactly as it was written, copied out of the input,
+// for decoding later once you know what it's meant to be
+type RawMessage []byte
+
+// RawValue is like RawMessage, but points straight into the input instead of copying it,
+// so it's only good for as long as nobody changes the bytes you unmarshalled from
+type RawValue []byte
+
+var rawMessageType = reflect.TypeOf(RawMessage{})
+
+var rawValueType = reflect.TypeOf(RawValue{})
+
+// isRawMessage spots encoding/json's RawMessage too, so types shared with it keep working
+func isRawMessage(t reflect.Type) bool {
+	return t == rawMessageType || (t.PkgPath() == "encoding/json" && t.Name() == "RawMessage")
+}
+
+// jsonRaw fills a byte slice with the exact bytes of a value, using the skip plan to find where it ends
+type jsonRaw struct {
+	rawType reflect.Type
+	alias   bool
+	skipper jsonStoredProcedure
+}
+
+func newJsonRaw(t reflect.Type, d *FastDescribers) jsonRaw {
+	return jsonRaw{
+		rawType: t,
+		alias:   t == rawValueType,
+		skipper: d.Describe(interfaceType),
+	}
+}
+
+func (j jsonRaw) ReportPlan(r *jsonReport) {
+	r.Then(`Search for the start of a value, returning if I find } or ]`)
+	r.Then(`Skip to the end of the value without decoding it`)
+	if j.alias {
+		r.Then(`Point the %s in the base at the bytes I skipped, without copying`, j.rawType)
+	} else {
+		r.Then(`Copy the bytes I skipped into the %s in the base`, j.rawType)
+	}
+}
+
+func (j jsonRaw) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
+	b := op.rawData
+	if verbose {
+		if op.mode == ModeSkip {
+			fmt.Println(fmt.Sprintf("%T", j), "discarding", j.rawType.String(), "in:", string(b[p:end]))
+		} else {
+			fmt.Println(fmt.Sprintf("%T", j), "consuming", j.rawType.String(), "in:", string(b[p:end]))
+		}
+	}
+
+	start := peekValue(b, p, end)
+	if start == end {
+		return end, ErrUnexpectedEOF
+	}
+	switch b[start] {
+	case ']':
+		return start, ErrUnexpectedListEnd
+	case '}':
+		return start, ErrUnexpectedMapEnd
+	}
+
+	skipOp := op
+	skipOp.mode = ModeSkip
+	n, err := j.skipper.IntoPointer(skipOp, start, end, unrealPointer)
+	if err != nil {
+		return n, err
+	}
+	if verbose {
+		fmt.Println("found raw value", string(b[start:n]))
+	}
+	if op.mode == ModeAlloc {
+		if j.alias {
+			*(*[]byte)(base) = b[start:n:n]
+		} else {
+			*(*[]byte)(base) = append([]byte(nil), b[start:n]...)
+		}
+	}
+	return n, nil
+}
+
+func (j jsonRaw) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	raw := *(*[]byte)(base)
+	if len(raw) == 0 {
+		return append(b, nullBytes...), nil
+	}
+	return append(b, raw...), nil
+}
+
+var bigIntType = reflect.TypeOf(big.Int{})
+
+var bigFloatType = reflect.TypeOf(big.Float{})
+
+var bigRatType = reflect.TypeOf(big.Rat{})
+
+// jsonBigNumber reads number literals straight into a big.Int, big.Float or big.Rat, so nothing has to fit a float64 first
+type jsonBigNumber struct {
+	numberType reflect.Type
+}
+
+func (j jsonBigNumber) ReportPlan(r *jsonReport) {
+	r.Then(`Search for a digit or -, returning if I find } or ], or leaving the base alone if I find null`)
+	r.Then(`Find the end of the number, checking it's a real one`)
+	switch j.numberType {
+	case bigIntType:
+		r.Then(`Set the big.Int in the base from the text I found, failing if it isn't a whole number`)
+	case bigFloatType:
+		r.Then(`Set the big.Float in the base from the text I found, with enough precision for every digit`)
+	case bigRatType:
+		r.Then(`Set the big.Rat in the base from the text I found, exactly`)
+	}
+}
+
+func (j jsonBigNumber) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
+	b := op.rawData
+	if verbose {
+		if op.mode == ModeSkip {
+			fmt.Println(fmt.Sprintf("%T", j), "discarding", j.numberType.String(), "in:", string(b[p:end]))
+		} else {
+			fmt.Println(fmt.Sprintf("%T", j), "consuming", j.numberType.String(), "in:", string(b[p:end]))
+		}
+	}
+
+	for p < end {
+		thisChar := b[p]
+		if thisChar == ']' {
+			return p, ErrUnexpectedListEnd
+		}
+		if thisChar == '}' {
+			return p, ErrUnexpectedMapEnd
+		}
+		if thisChar == 'n' {
+			return readNull(b, p, end)
+		}
+		if kind := jsonKind(thisChar); kind != "" && kind != "number" {
+			return p, &UnmarshalTypeError{Value: kind, Offset: p}
+		}
+		if thisChar == '-' || (thisChar >= '0' && thisChar <= '9') {
+			n, err := scanNumber(b, p, end)
+			if err != nil {
+				return n, err
+			}
+			if verbose {
+				fmt.Println("found big number", string(b[p:n]))
+			}
+			if op.mode == ModeAlloc {
+				if err := j.set(string(b[p:n]), base); err != nil {
+					return p, &UnmarshalTypeError{Value: "number " + string(b[p:n]), Offset: p}
+				}
+			}
+			return n, nil
+		}
+		p += 1
+	}
+
+	return end, ErrUnexpectedEOF
+}
+
+func (j jsonBigNumber) set(literal string, base unsafe.Pointer) error {
+	switch j.numberType {
+	case bigIntType:
+		z := (*big.Int)(base)
+		if _, ok := z.SetString(literal, 10); ok {
+			return nil
+		}
+		// something like 1e3 is still a whole number
+		r, ok := new(big.Rat).SetString(literal)
+		if !ok || !r.IsInt() {
+			return ErrNotInteger
+		}
+		z.Set(r.Num())
+	case bigFloatType:
+		z := (*big.Float)(base)
+		if z.Prec() == 0 {
+			// a little over log2(10) bits for each digit
+			z.SetPrec(uint(len(literal))*3322/1000 + 64)
+		}
+		if _, ok := z.SetString(literal); !ok {
+			return ErrNumberOverflow
+		}
+	case bigRatType:
+		if _, ok := (*big.Rat)(base).SetString(literal); !ok {
+			return ErrInvalidNumber
+		}
+	}
+	return nil
+}
+
+func (j jsonBigNumber) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	switch j.numberType {
+	case bigIntType:
+		return (*big.Int)(base).Append(b, 10), nil
+	case bigFloatType:
+		z := (*big.Float)(base)
+		if z.IsInf() {
+			return b, ErrUnsupportedFloat
+		}
+		return z.Append(b, 'g', -1), nil
+	default:
+		r := (*big.Rat)(base)
+		if r.IsInt() {
+			return r.Num().Append(b, 10), nil
+		}
+		if digits, ok := decimalPlaces(r.Denom()); ok {
+			return append(b, r.FloatString(digits)...), nil
+		}
+		// a fraction that never ends in decimal gets as close as a float64 would
+		f, _ := r.Float64()
+		return appendFloat(b, f, 64)
+	}
+}
+
+// decimalPlaces works out how many places a fraction with this denominator needs to be written exactly,
+// which is only possible when the denominator is made of twos and fives
+func decimalPlaces(denom *big.Int) (int, bool) {
+	twos := int(denom.TrailingZeroBits())
+	d := new(big.Int).Rsh(denom, uint(twos))
+
+	five := big.NewInt(5)
+	q, m := new(big.Int), new(big.Int)
+	fives := 0
+	for {
+		q.QuoRem(d, five, m)
+		if m.Sign() != 0 {
+			break
+		}
+		d.Set(q)
+		fives += 1
+	}
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return 0, false
+	}
+	if twos > fives {
+		return twos, true
+	}
+	return fives, true
+}
+
+type jsonFloat struct {
+	bits int
+}
+
+func newJsonFloat(r reflect.Type, des describer, bits int) jsonFloat {
+	return jsonFloat{bits: bits}
+}
+
+func (j jsonFloat) ReportPlan(r *jsonReport) {
+	r.Then(`Search for a digit or -, returning if I find } or ], or leaving the base alone if I find null`)
+	r.Then(`Read the digits, fraction and exponent as a %d bit float`, j.bits)
+	r.Then(`Write the float into the base`)
+}
+
+func (j jsonFloat) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
+	b := op.rawData
+	if verbose {
+		if op.mode == ModeSkip {
+			fmt.Println(fmt.Sprintf("%T", j), "discarding float in:", string(b[p:end]))
+		} else {
+			fmt.Println(fmt.Sprintf("%T", j), "consuming float in:", string(b[p:end]))
+		}
+	}
+
+	for p < end {
+		thisChar := b[p]
 		if thisChar == ']' {
 			return p, ErrUnexpectedListEnd
 		}
 		if thisChar == '}' {
 			return p, ErrUnexpectedMapEnd
 		}
-
-		p += 1
-		if thisChar == '{' {
-			mapStart := p - 1
-			for p < end {
-			anotherKey:
-				n, err := jsonRawString{}.IntoPointer(op, p, end, lPtr)
-				if err != nil {
-					if err != ErrUnexpectedMapEnd {
-						return n, err
-					}
-					if verbose {
-						fmt.Println("found map:", string(b[mapStart:n+1]))
-					}
-					return n + 1, nil
-				}
-
-				p = n
-				for p < end {
-					thisChar := b[p]
-					p += 1
-					if thisChar == ':' {
-						n, err := jsonEscapedString{}.IntoPointer(op, p, end, rPtr)
-						if err != nil {
-							return n, err
-						}
-						p = n
-						if store {
-							cMap[lStr] = rStr
-						}
-						goto anotherKey
-					}
+		if thisChar == 'n' {
+			return readNull(b, p, end)
+		}
+		if kind := jsonKind(thisChar); kind != "" && kind != "number" {
+			return p, &UnmarshalTypeError{Value: kind, Offset: p}
+		}
+		if thisChar == '-' || (thisChar >= '0' && thisChar <= '9') {
+			f, n, err := parseFloat(b, p, end, j.bits)
+			if err != nil {
+				return n, err
+			}
+			if verbose {
+				fmt.Println("found float", string(b[p:n]), "=", f)
+			}
+			if op.mode == ModeAlloc {
+				if j.bits == 32 {
+					*(*float32)(base) = float32(f)
+				} else {
+					*(*float64)(base) = f
 				}
-				return end, ErrNoQuote
 			}
-			return end, ErrNoBrace
+			return n, nil
 		}
+		p += 1
 	}
-	return end, ErrNoBrace
-}
 
-type jsonNumber struct {
-	bits   int
-	signed bool
+	return end, ErrUnexpectedEOF
 }
 
-func newJsonNumber(r reflect.Type, des describer, signed bool, bits int) jsonNumber {
-	return jsonNumber{bits: bits, signed: signed}
+func (j jsonFloat) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	var f float64
+	if j.bits == 32 {
+		f = float64(*(*float32)(base))
+	} else {
+		f = *(*float64)(base)
+	}
+	return appendFloat(b, f, j.bits)
 }
 
-func (j jsonNumber) ReportPlan(r *jsonReport) {
-	r.Then("Somehow fill out the *int passed to me")
+var float64pow10 = [...]float64{
+	1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9,
+	1e10, 1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19,
+	1e20, 1e21, 1e22,
 }
 
-func (j jsonNumber) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
-	if verbose {
-		fmt.Println("looking at int", *(*int)(base))
+var float32pow10 = [...]float32{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10}
+
+// parseFloat reads the number literal starting at p, returning the float and where the literal ends.
+// Anything that can be computed with a single correctly rounded operation is done here, the rest is
+// handed to strconv so that the result always matches strconv.ParseFloat
+func parseFloat(b []byte, p, end, bits int) (float64, int, error) {
+	start := p
+	negative := b[p] == '-'
+	if negative {
+		p += 1
 	}
 
-	for p < end {
-		thisChar := op.rawData[p]
-		if thisChar >= '0' && thisChar <= '9' {
-			start := p
-			if verbose {
-				fmt.Println("found int at?", string(op.rawData[start:start+2]))
+	var mantissa uint64
+	digits, exp := 0, 0
+	truncated := false
+
+	intStart := p
+	for p < end && b[p] >= '0' && b[p] <= '9' {
+		if digits < 19 {
+			mantissa = mantissa*10 + uint64(b[p]-'0')
+			if mantissa != 0 {
+				digits += 1
+			}
+		} else {
+			truncated = true
+			exp += 1
+		}
+		p += 1
+	}
+	if p == intStart {
+		return 0, p, ErrNoDigits
+	}
+
+	if p < end && b[p] == '.' {
+		p += 1
+		fracStart := p
+		for p < end && b[p] >= '0' && b[p] <= '9' {
+			if digits < 19 {
+				mantissa = mantissa*10 + uint64(b[p]-'0')
+				if mantissa != 0 {
+					digits += 1
+				}
+				exp -= 1
+			} else {
+				truncated = true
 			}
+			p += 1
+		}
+		if p == fracStart {
+			return 0, p, ErrNoDigits
 		}
+	}
+
+	if p < end && (b[p] == 'e' || b[p] == 'E') {
 		p += 1
+		expNegative := false
+		if p < end && (b[p] == '+' || b[p] == '-') {
+			expNegative = b[p] == '-'
+			p += 1
+		}
+		expStart := p
+		e := 0
+		for p < end && b[p] >= '0' && b[p] <= '9' {
+			if e < 100000 {
+				e = e*10 + int(b[p]-'0')
+			}
+			p += 1
+		}
+		if p == expStart {
+			return 0, p, ErrNoDigits
+		}
+		if expNegative {
+			exp -= e
+		} else {
+			exp += e
+		}
+	}
+
+	if !truncated {
+		if bits == 64 && mantissa <= 1<<53 && exp >= -22 && exp <= 22 {
+			f := float64(mantissa)
+			if exp < 0 {
+				f /= float64pow10[-exp]
+			} else {
+				f *= float64pow10[exp]
+			}
+			if negative {
+				f = -f
+			}
+			return f, p, nil
+		}
+		if bits == 32 && mantissa <= 1<<24 && exp >= -10 && exp <= 10 {
+			f := float32(mantissa)
+			if exp < 0 {
+				f /= float32pow10[-exp]
+			} else {
+				f *= float32pow10[exp]
+			}
+			if negative {
+				f = -f
+			}
+			return float64(f), p, nil
+		}
+	}
+
+	f, err := strconv.ParseFloat(string(b[start:p]), bits)
+	if err != nil {
+		return 0, start, &UnmarshalTypeError{Value: "number " + string(b[start:p]), Offset: start}
+	}
+	return f, p, nil
+}
+
+// appendFloat writes f the same way encoding/json would, switching to an exponent for very big or small numbers
+func appendFloat(b []byte, f float64, bits int) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return b, ErrUnsupportedFloat
 	}
 
-	return p, ErrUnexpectedEOF
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	b = strconv.AppendFloat(b, f, format, -1, bits)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b, nil
 }
 
 type jsonMap struct {
@@ -659,9 +2592,12 @@ type jsonMap struct {
 	rightType reflect.Type
 }
 
-func newJsonMap(r reflect.Type, des describer) *jsonMap {
+func newJsonMap(r reflect.Type, des describer) jsonStoredProcedure {
 	j := &jsonMap{}
-	j.left = jsonRawString{}
+	j.left = newMapKey(r.Key(), des)
+	if j.left == nil {
+		return newJsonUnsupported(r, "map keys have to be strings, integers or implement encoding.TextUnmarshaler", des)
+	}
 	j.leftType = r.Key()
 
 	j.right = des.Describe(r.Elem())
@@ -671,8 +2607,89 @@ func newJsonMap(r reflect.Type, des describer) *jsonMap {
 	return j
 }
 
+// newMapKey picks how to read keys of type t, in the same order of preference as encoding/json,
+// or returns nil if there's no way to. Keys are always quoted in json, so numbers are read from inside the quotes
+func newMapKey(t reflect.Type, des describer) jsonStoredProcedure {
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return jsonTextKey{keyType: t}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return jsonEscapedString{}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &jsonQuoted{inner: newJsonNumber(t, des, true, t.Bits())}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &jsonQuoted{inner: newJsonNumber(t, des, false, t.Bits())}
+	}
+	return nil
+}
+
+// keyText is the text a map key gets written as, in the same order of preference as encoding/json
+func keyText(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return "", nil
+		}
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", ErrUnsupportedKey
+}
+
+// jsonTextKey reads a quoted key and hands its text to the key type's UnmarshalText
+type jsonTextKey struct {
+	keyType reflect.Type
+}
+
+func (j jsonTextKey) ReportPlan(r *jsonReport) {
+	r.Then(`Search for ", returning if I find } or ]`)
+	r.Then(`Read the string, and hand its text to (*%s).UnmarshalText`, j.keyType)
+}
+
+func (j jsonTextKey) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
+	b := op.rawData
+	if verbose {
+		if op.mode == ModeSkip {
+			fmt.Println(fmt.Sprintf("%T", j), "discarding", j.keyType.String(), "key in:", string(b[p:end]))
+		} else {
+			fmt.Println(fmt.Sprintf("%T", j), "consuming", j.keyType.String(), "key in:", string(b[p:end]))
+		}
+	}
+
+	var text string
+	start := peekValue(b, p, end)
+	n, err := jsonEscapedString{}.IntoPointer(op, p, end, unsafe.Pointer(&text))
+	if err != nil {
+		return n, err
+	}
+	if op.mode == ModeAlloc {
+		if err := reflect.NewAt(j.keyType, base).Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+			return start, err
+		}
+	}
+	return n, nil
+}
+
+func (j jsonTextKey) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	text, err := keyText(reflect.NewAt(j.keyType, base).Elem())
+	if err != nil {
+		return b, err
+	}
+	return appendQuoted(b, text), nil
+}
+
 func (j jsonMap) ReportPlan(r *jsonReport) {
-	r.Then(`Look for a {, create a ` + j.all.String() + ` in the base pointer using reflection, then repeatedly:`)
+	r.Then(`If I get a null, set the %s to nil`, j.all)
+	r.Then(`Otherwise look for a {, create a %s in the base pointer using reflection, then repeatedly:`, j.all)
 	func() {
 		defer r.Deeper()()
 		func() {
@@ -705,10 +2722,6 @@ func (j jsonMap) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer
 
 	if store {
 		currentMap = reflect.Indirect(reflect.NewAt(j.all, base))
-		if reflect.Indirect(currentMap).IsNil() {
-			newMap := reflect.Indirect(reflect.MakeMapWithSize(j.all, defaultMapSize))
-			currentMap.Set(newMap)
-		}
 
 		// itemSize := j.rightType.Size()
 
@@ -731,12 +2744,31 @@ func (j jsonMap) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer
 		if thisChar == '}' {
 			return p, ErrUnexpectedMapEnd
 		}
+		if thisChar == 'n' {
+			n, err := readNull(b, p, end)
+			if err == nil && store {
+				currentMap.Set(reflect.Zero(j.all))
+			}
+			return n, err
+		}
 
+		if kind := jsonKind(thisChar); kind != "" && kind != "object" {
+			return p, &UnmarshalTypeError{Value: kind, Offset: p}
+		}
 		p += 1
 		if thisChar == '{' {
+			if store && currentMap.IsNil() {
+				newMap := reflect.Indirect(reflect.MakeMapWithSize(j.all, defaultMapSize))
+				currentMap.Set(newMap)
+			}
 			mapStart := p - 1
 			for p < end {
 			anotherKey:
+				if store {
+					// the same space is used for every entry, so clear out whatever the last one left there
+					reflect.Indirect(lSide).Set(reflect.Zero(j.leftType))
+					reflect.Indirect(rSide).Set(reflect.Zero(j.rightType))
+				}
 				n, err := j.left.IntoPointer(op, p, end, lPtr)
 				if err != nil {
 					if err != ErrUnexpectedMapEnd {
@@ -747,15 +2779,29 @@ func (j jsonMap) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer
 					}
 					return n + 1, nil
 				}
+				key := rawKey(b, p, n)
 				p = n
+				keyEnd := p
 				for p < end {
 					thisChar := b[p]
 					p += 1
 					if thisChar == ':' {
+						op.enter(pathStep{key: key})
 						n, err := j.right.IntoPointer(op, p, end, rPtr)
 						if err != nil {
-							return n, err
+							n, err = op.carryOn(n, end, err, j.rightType)
+							op.leave()
+							if err != nil {
+								return n, atPath(err, keyStep(key), j.rightType, "")
+							}
+							// skipped, but the key still gets a value like in encoding/json
+							if store {
+								currentMap.SetMapIndex(reflect.Indirect(lSide), reflect.Zero(j.rightType))
+							}
+							p = n
+							goto anotherKey
 						}
+						op.leave()
 						p = n
 						if store {
 							currentMap.SetMapIndex(reflect.Indirect(lSide), reflect.Indirect(rSide))
@@ -763,23 +2809,329 @@ func (j jsonMap) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer
 						goto anotherKey
 					}
 				}
-				return end, ErrNoColon
+				return keyEnd, ErrNoColon
 			}
 		}
 	}
 	return end, ErrNoBrace
 }
 
+func (j jsonMap) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	currentMap := reflect.Indirect(reflect.NewAt(j.all, base))
+	if currentMap.IsNil() {
+		return append(b, nullBytes...), nil
+	}
+	step := encodeStep{ptr: currentMap.Pointer()}
+	if err := e.enter(step, j.all); err != nil {
+		return b, err
+	}
+	defer e.leave(step)
+
+	mapKeys := currentMap.MapKeys()
+	keys := make([]string, len(mapKeys))
+	for i, k := range mapKeys {
+		text, err := keyText(k)
+		if err != nil {
+			return b, err
+		}
+		keys[i] = text
+	}
+	sort.Sort(byKeyText{keys, mapKeys})
+
+	// values in a map aren't addressable, so each one is copied out before being written
+	rSide := reflect.New(j.rightType)
+	rPtr := unsafe.Pointer(rSide.Pointer())
+
+	b = append(b, '{')
+	for i, k := range mapKeys {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendQuoted(b, keys[i])
+		b = append(b, ':')
+		reflect.Indirect(rSide).Set(currentMap.MapIndex(k))
+		var err error
+		b, err = j.right.FromPointer(e, b, rPtr)
+		if err != nil {
+			return b, err
+		}
+	}
+	return append(b, '}'), nil
+}
+
+// byKeyText sorts map keys by the text they're written as, keeping the real keys alongside
+type byKeyText struct {
+	text []string
+	keys []reflect.Value
+}
+
+func (s byKeyText) Len() int           { return len(s.text) }
+func (s byKeyText) Less(a, b int) bool { return s.text[a] < s.text[b] }
+func (s byKeyText) Swap(a, b int) {
+	s.text[a], s.text[b] = s.text[b], s.text[a]
+	s.keys[a], s.keys[b] = s.keys[b], s.keys[a]
+}
+
 type field struct {
-	natural bool
-	offset  uintptr
-	bytes   []byte
+	natural   bool
+	offset    uintptr
+	bytes     []byte
+	goName    string
+	tagged    bool
+	options   tagOptions
+	fieldType reflect.Type
+	handler   jsonStoredProcedure
+
+	// embedded pointers that have to be followed before offset applies, for fields promoted through a *T
+	embedded []embeddedPointer
+	// the chain of field indexes used to reach this field, and the embedded types along the way
+	index []int
+	via   []string
+}
+
+type embeddedPointer struct {
+	offset   uintptr
+	ptrType  reflect.Type
+	exported bool
 }
 
 func (f field) String() string {
 	return fmt.Sprintf(`%s at %d`, string(f.bytes), f.offset)
 }
 
+// describeTag explains where the key came from, if it wasn't just the name of the field
+func (f field) describeTag() string {
+	var notes []string
+	if f.tagged {
+		notes = append(notes, "the tag on "+f.goName)
+	}
+	if f.options != "" {
+		notes = append(notes, "with "+string(f.options))
+	}
+	if len(f.via) > 0 {
+		notes = append(notes, "promoted from "+strings.Join(f.via, "."))
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(notes, ", ") + ")"
+}
+
+// follow finds where the field lives in the struct at base, creating any embedded pointers on the way.
+// An unexported embedded pointer is never created, so it gives up with a nil if it finds one missing
+func (f field) follow(base unsafe.Pointer) unsafe.Pointer {
+	for _, e := range f.embedded {
+		curPtr := reflect.Indirect(reflect.NewAt(e.ptrType, unsafe.Pointer(uintptr(base)+e.offset)))
+		if curPtr.IsNil() {
+			if !e.exported {
+				return nil
+			}
+			if verbose {
+				fmt.Println("new embedded", e.ptrType.Elem().String())
+			}
+			curPtr.Set(reflect.New(e.ptrType.Elem()))
+		}
+		base = unsafe.Pointer(curPtr.Pointer())
+	}
+	return unsafe.Pointer(uintptr(base) + f.offset)
+}
+
+// reach is like follow, but gives up with a nil if an embedded pointer hasn't been created
+func (f field) reach(base unsafe.Pointer) unsafe.Pointer {
+	for _, e := range f.embedded {
+		base = *(*unsafe.Pointer)(unsafe.Pointer(uintptr(base) + e.offset))
+		if base == nil {
+			return nil
+		}
+	}
+	return unsafe.Pointer(uintptr(base) + f.offset)
+}
+
+// before orders fields the way they're declared, with promoted fields where their embedded struct is
+func (f field) before(than field) bool {
+	for i, x := range f.index {
+		if i >= len(than.index) {
+			return false
+		}
+		if x != than.index[i] {
+			return x < than.index[i]
+		}
+	}
+	return len(f.index) < len(than.index)
+}
+
+// collectFields finds every field that can be filled from a key, promoting the fields of embedded structs
+// and settling clashes between them the way go does: the shallowest field wins, a tag breaks a tie,
+// and if that still doesn't settle it then nobody gets the key.
+// Unexported fields are left alone, unless they're embedded structs with exported fields to promote
+func collectFields(obj reflect.Type) []field {
+	type embedding struct {
+		typ      reflect.Type
+		offset   uintptr
+		embedded []embeddedPointer
+		index    []int
+		via      []string
+	}
+
+	var found []field
+	visited := map[reflect.Type]bool{}
+	next := []embedding{{typ: obj}}
+
+	for len(next) > 0 {
+		current := next
+		next = nil
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			for i := 0; i < e.typ.NumField(); i++ {
+				f := e.typ.Field(i)
+
+				tag := f.Tag.Get("json")
+				if tag == "-" {
+					if verbose {
+						fmt.Printf("jsonObject: %s.%s is tagged to be ignored\n", e.typ.String(), f.Name)
+					}
+					continue
+				}
+				name, options := parseTag(tag)
+
+				index := make([]int, len(e.index)+1)
+				copy(index, e.index)
+				index[len(e.index)] = i
+
+				exported := f.PkgPath == ""
+				if f.Anonymous {
+					t := f.Type
+					if t.Kind() == reflect.Ptr && t.Name() == "" {
+						t = t.Elem()
+					}
+					if !exported && t.Kind() != reflect.Struct {
+						if verbose {
+							fmt.Printf("jsonObject: %s.%s is unexported\n", e.typ.String(), f.Name)
+						}
+						continue
+					}
+				} else if !exported {
+					if verbose {
+						fmt.Printf("jsonObject: %s.%s is unexported\n", e.typ.String(), f.Name)
+					}
+					continue
+				}
+
+				if f.Anonymous && name == "" {
+					t := f.Type
+					if t.Kind() == reflect.Ptr && t.Name() == "" {
+						t = t.Elem()
+					}
+					if t.Kind() == reflect.Struct {
+						inner := embedding{typ: t, offset: e.offset + f.Offset, embedded: e.embedded, index: index, via: append(e.via[:len(e.via):len(e.via)], t.Name())}
+						if f.Type.Kind() == reflect.Ptr {
+							inner.embedded = append(e.embedded[:len(e.embedded):len(e.embedded)], embeddedPointer{offset: e.offset + f.Offset, ptrType: f.Type, exported: exported})
+							inner.offset = 0
+						}
+						next = append(next, inner)
+						continue
+					}
+				}
+
+				tagged := name != ""
+				if !tagged {
+					name = f.Name
+				}
+				found = append(found, field{
+					offset: e.offset + f.Offset, bytes: []byte(name), goName: f.Name, tagged: tagged, options: options,
+					fieldType: f.Type, embedded: e.embedded, index: index, via: e.via,
+				})
+			}
+		}
+		// a type embedded twice at the same depth is visited twice, so its fields cancel each other out
+		for _, e := range current {
+			visited[e.typ] = true
+		}
+	}
+
+	sort.SliceStable(found, func(a, b int) bool {
+		x, y := found[a], found[b]
+		if string(x.bytes) != string(y.bytes) {
+			return string(x.bytes) < string(y.bytes)
+		}
+		if len(x.index) != len(y.index) {
+			return len(x.index) < len(y.index)
+		}
+		if x.tagged != y.tagged {
+			return x.tagged
+		}
+		return x.before(y)
+	})
+
+	winners := found[:0]
+	for i := 0; i < len(found); {
+		j := i + 1
+		for j < len(found) && string(found[j].bytes) == string(found[i].bytes) {
+			j += 1
+		}
+		contenders := found[i:j]
+		if len(contenders) == 1 {
+			winners = append(winners, contenders[0])
+		} else if len(contenders[0].index) < len(contenders[1].index) || contenders[0].tagged && !contenders[1].tagged {
+			winners = append(winners, contenders[0])
+		} else if verbose {
+			fmt.Printf("jsonObject: nobody in %s gets %#v\n", obj.String(), string(found[i].bytes))
+		}
+		i = j
+	}
+
+	sort.Slice(winners, func(a, b int) bool {
+		return winners[a].before(winners[b])
+	})
+	return winners
+}
+
+// tagOptions is everything after the name in a json struct tag, like "omitempty,string"
+type tagOptions string
+
+func parseTag(tag string) (string, tagOptions) {
+	if i := strings.Index(tag, ","); i != -1 {
+		return tag[:i], tagOptions(tag[i+1:])
+	}
+	return tag, ""
+}
+
+func (o tagOptions) Contains(option string) bool {
+	s := string(o)
+	for s != "" {
+		var next string
+		if i := strings.Index(s, ","); i != -1 {
+			s, next = s[:i], s[i+1:]
+		}
+		if s == option {
+			return true
+		}
+		s = next
+	}
+	return false
+}
+
+// isEmptyValue is what omitempty considers empty
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
 func (f field) Less(than []byte) bool {
 	i := 0
 	for {
@@ -851,13 +3203,31 @@ func (f fields) Swap(a, b int) {
 
 type jsonObject struct {
 	fields     fields
-	offsets    []jsonStoredProcedure
+	ordered    fields
 	def        jsonStoredProcedure
 	structType reflect.Type
 }
 
-func (j *jsonObject) addName(name string, offset uintptr, natural bool) {
-	j.fields = append(j.fields, field{offset: offset, bytes: []byte(name), natural: natural})
+func (j *jsonObject) addName(f field, name string, natural bool) {
+	f.bytes = []byte(name)
+	f.natural = natural
+	j.fields = append(j.fields, f)
+	if natural {
+		j.ordered = append(j.ordered, f)
+	}
+}
+
+// addField registers the key for a field, plus its lower and upper case forms if nobody else has them
+func (j *jsonObject) addField(f field, taken map[string]bool) {
+	name := string(f.bytes)
+	j.addName(f, name, true)
+	for _, alias := range []string{strings.ToLower(name), strings.ToUpper(name)} {
+		if taken[alias] {
+			continue
+		}
+		taken[alias] = true
+		j.addName(f, alias, false)
+	}
 }
 
 func (j jsonObject) String() string {
@@ -865,23 +3235,30 @@ func (j jsonObject) String() string {
 }
 
 func newJsonObject(obj reflect.Type, des describer) *jsonObject {
-	offsets := make([]jsonStoredProcedure, int(obj.Size()), int(obj.Size()))
-	j := &jsonObject{offsets: offsets}
-	for i := 0; i < obj.NumField(); i++ {
-		f := obj.Field(i)
-		j.addName(f.Name, f.Offset, true)
-		j.addName(strings.ToLower(f.Name), f.Offset, false)
-		j.addName(strings.ToUpper(f.Name), f.Offset, false)
-		offsets[f.Offset] = des.Describe(f.Type)
+	j := &jsonObject{}
+
+	found := collectFields(obj)
+	taken := make(map[string]bool, len(found))
+	for _, f := range found {
+		taken[string(f.bytes)] = true
+	}
+
+	for _, f := range found {
+		if f.options.Contains("string") {
+			f.handler = newJsonQuoted(f.fieldType, des)
+		}
+		if f.handler == nil {
+			f.handler = des.Describe(f.fieldType)
+		}
+		j.addField(f, taken)
 		if verbose {
-			fmt.Printf("jsonObject: for %s.%s, use %#v\n", obj.String(), f.Name, offsets[f.Offset])
+			fmt.Printf("jsonObject: for %s.%s, use %#v\n", obj.String(), f.goName, f.handler)
 		}
 	}
 
 	j.structType = obj
 
-	var anything []interface{}
-	j.def = des.Describe(reflect.TypeOf(anything).Elem())
+	j.def = des.Describe(interfaceType)
 
 	if verbose {
 		fmt.Println("sorting fields", j.fields)
@@ -895,7 +3272,8 @@ func newJsonObject(obj reflect.Type, des describer) *jsonObject {
 }
 
 func (j jsonObject) ReportPlan(r *jsonReport) {
-	r.Then(`Look for a {, then repeatedly:`)
+	r.Then(`If I get a null, leave the %s alone`, j.structType)
+	r.Then(`Otherwise look for a {, then repeatedly:`)
 	func() {
 		defer r.Deeper()()
 		r.Then("Get a key by scanning for raw bytes")
@@ -905,10 +3283,10 @@ func (j jsonObject) ReportPlan(r *jsonReport) {
 			if !f.natural {
 				continue
 			}
-			r.Then("If the key is like %#v, I'll:", string(f.bytes))
+			r.Then("If the key is like %#v%s, I'll:", string(f.bytes), f.describeTag())
 			func() {
 				defer r.Deeper()()
-				j.offsets[f.offset].ReportPlan(r)
+				f.handler.ReportPlan(r)
 			}()
 		}
 		r.Then("If it's any other key, I'll:")
@@ -934,7 +3312,13 @@ func (j jsonObject) IntoPointer(op decodeOperation, p, end int, base unsafe.Poin
 		if thisChar == '}' {
 			return p, ErrUnexpectedMapEnd
 		}
+		if thisChar == 'n' {
+			return readNull(b, p, end)
+		}
 
+		if kind := jsonKind(thisChar); kind != "" && kind != "object" {
+			return p, &UnmarshalTypeError{Value: kind, Offset: p}
+		}
 		p += 1
 		if thisChar == '{' {
 			var handler jsonStoredProcedure
@@ -951,7 +3335,9 @@ func (j jsonObject) IntoPointer(op decodeOperation, p, end int, base unsafe.Poin
 						thisChar := b[p]
 						p += 1
 						if thisChar == '"' {
+							// unknown keys are skipped, so they mustn't see the last field's pointer
 							handler = j.def
+							offset = unrealPointer
 
 							if verbose {
 								fmt.Println("found key", string(b[start:p-1]))
@@ -981,14 +3367,24 @@ func (j jsonObject) IntoPointer(op decodeOperation, p, end int, base unsafe.Poin
 							}
 
 							op := op
+							var fieldType reflect.Type
+							var goName string
 							if foundN < len(j.fields) {
 								f := j.fields[foundN]
 								if f.Equal(bytes) {
+									fieldType, goName = f.fieldType, f.goName
 									if verbose {
 										fmt.Println("found handler for key", f)
 									}
-									offset = unsafe.Pointer(uintptr(base) + f.offset)
-									handler = j.offsets[f.offset]
+									if op.mode == ModeAlloc {
+										offset = f.follow(base)
+										if offset == nil {
+											return start, ErrUnexportedEmbedded
+										}
+									} else {
+										offset = unrealPointer
+									}
+									handler = f.handler
 								} else {
 									if verbose {
 										fmt.Println("key was not found")
@@ -1001,21 +3397,37 @@ func (j jsonObject) IntoPointer(op decodeOperation, p, end int, base unsafe.Poin
 								}
 								op.mode = ModeSkip
 							}
+							if handler == j.def {
+								if err := op.unknownKey(bytes, j.structType, start-1); err != nil {
+									return start - 1, err
+								}
+							}
 
+							keyEnd := p
 							for p < end {
 								thisChar := b[p]
 								p += 1
 								if thisChar == ':' {
+									op.enter(pathStep{key: bytes, field: goName})
 									n, err := handler.IntoPointer(op, p, end, offset)
 									if err != nil {
-										return n, err
+										n, err = op.carryOn(n, end, err, fieldType)
+									}
+									op.leave()
+									if err != nil {
+										return n, atPath(err, keyStep(bytes), fieldType, goName)
 									}
 									p = n
-									goto anotherKey
+									if p < end {
+										goto anotherKey
+									}
+									return end, ErrNoBrace
 								}
 							}
+							return keyEnd, ErrNoColon
 						}
 					}
+					return end, ErrNoQuote
 				}
 				if thisChar == '}' {
 					if verbose {
@@ -1024,11 +3436,39 @@ func (j jsonObject) IntoPointer(op decodeOperation, p, end int, base unsafe.Poin
 					return p, nil
 				}
 			}
+			return end, ErrNoBrace
 		}
 	}
 	return end, ErrNoBraceOpen
 }
 
+func (j jsonObject) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	b = append(b, '{')
+	first := true
+	for _, f := range j.ordered {
+		offset := f.reach(base)
+		if offset == nil {
+			// promoted from an embedded pointer that isn't there
+			continue
+		}
+		if f.options.Contains("omitempty") && isEmptyValue(reflect.Indirect(reflect.NewAt(f.fieldType, offset))) {
+			continue
+		}
+		if !first {
+			b = append(b, ',')
+		}
+		first = false
+		b = appendQuoted(b, string(f.bytes))
+		b = append(b, ':')
+		var err error
+		b, err = f.handler.FromPointer(e, b, offset)
+		if err != nil {
+			return b, err
+		}
+	}
+	return append(b, '}'), nil
+}
+
 func quickScan(b []byte) (ids [][3]int) {
 	end := len(b)
 	p := 0
@@ -1048,7 +3488,10 @@ func quickScan(b []byte) (ids [][3]int) {
 				if thisChar == '"' {
 					strEnd := p
 					ids = append(ids, [3]int{start, strEnd, 0})
-					goto anotherElement
+					if p < end {
+						goto anotherElement
+					}
+					return
 				}
 			}
 		}
@@ -1056,6 +3499,152 @@ func quickScan(b []byte) (ids [][3]int) {
 	return
 }
 
+// maxDepth is how deeply objects and lists can nest before strict scanning gives up, the same limit as encoding/json
+const maxDepth = 10000
+
+// skipSpace skips only the whitespace RFC 8259 allows between tokens
+func skipSpace(b []byte, p, end int) int {
+	for p < end {
+		switch b[p] {
+		case ' ', '\t', '\r', '\n':
+			p += 1
+		default:
+			return p
+		}
+	}
+	return p
+}
+
+// scanDocument checks that b is exactly one value following RFC 8259, with nothing but whitespace around it
+func scanDocument(b []byte) (int, error) {
+	end := len(b)
+	n, err := scanStrict(b, 0, end, 0)
+	if err != nil {
+		return n, err
+	}
+	if n = skipSpace(b, n, end); n != end {
+		return n, ErrTrailingData
+	}
+	return n, nil
+}
+
+// scanString finds the end of the string whose opening quote is at p, only slowing down to check escapes if there are any
+func scanString(b []byte, p, end int) (int, error) {
+	for q := p + 1; q < end; q++ {
+		thisChar := b[q]
+		if thisChar == '"' {
+			return q + 1, nil
+		}
+		if thisChar == '\\' {
+			return unescapeString(decodeOperation{rawData: b, mode: ModeSkip}, p+1, q, end, unrealPointer)
+		}
+		if thisChar < 0x20 {
+			return q, ErrControlCharacter
+		}
+	}
+	return end, ErrNoQuote
+}
+
+// scanStrict checks the value starting at p follows RFC 8259 exactly, without decoding any of it, and returns where it ends
+func scanStrict(b []byte, p, end, depth int) (int, error) {
+	p = skipSpace(b, p, end)
+	if p == end {
+		return end, ErrUnexpectedEOF
+	}
+
+	switch thisChar := b[p]; {
+	case thisChar == '{':
+		if depth >= maxDepth {
+			return p, ErrTooDeep
+		}
+		p = skipSpace(b, p+1, end)
+		if p < end && b[p] == '}' {
+			return p + 1, nil
+		}
+		for {
+			if p == end {
+				return end, ErrNoBrace
+			}
+			if b[p] != '"' {
+				return p, ErrNoQuoteOpen
+			}
+			n, err := scanString(b, p, end)
+			if err != nil {
+				return n, err
+			}
+			p = skipSpace(b, n, end)
+			if p == end || b[p] != ':' {
+				return p, ErrNoColon
+			}
+			n, err = scanStrict(b, p+1, end, depth+1)
+			if err != nil {
+				return n, err
+			}
+			p = skipSpace(b, n, end)
+			if p == end {
+				return end, ErrNoBrace
+			}
+			if b[p] == '}' {
+				return p + 1, nil
+			}
+			if b[p] != ',' {
+				return p, ErrNoComma
+			}
+			p = skipSpace(b, p+1, end)
+		}
+	case thisChar == '[':
+		if depth >= maxDepth {
+			return p, ErrTooDeep
+		}
+		p = skipSpace(b, p+1, end)
+		if p < end && b[p] == ']' {
+			return p + 1, nil
+		}
+		for {
+			n, err := scanStrict(b, p, end, depth+1)
+			if err != nil {
+				return n, err
+			}
+			p = skipSpace(b, n, end)
+			if p == end {
+				return end, ErrNoBracket
+			}
+			if b[p] == ']' {
+				return p + 1, nil
+			}
+			if b[p] != ',' {
+				return p, ErrNoComma
+			}
+			p += 1
+		}
+	case thisChar == '"':
+		return scanString(b, p, end)
+	case thisChar == 't':
+		if n, ok := readLiteral(b, p, end, "true"); ok {
+			return n, nil
+		}
+		return p, ErrNoBool
+	case thisChar == 'f':
+		if n, ok := readLiteral(b, p, end, "false"); ok {
+			return n, nil
+		}
+		return p, ErrNoBool
+	case thisChar == 'n':
+		return readNull(b, p, end)
+	case thisChar == '-' || thisChar >= '0' && thisChar <= '9':
+		// no leading zeros, which scanNumber would let through
+		digits := p
+		if thisChar == '-' {
+			digits += 1
+		}
+		if digits+1 < end && b[digits] == '0' && b[digits+1] >= '0' && b[digits+1] <= '9' {
+			return digits, ErrInvalidNumber
+		}
+		return scanNumber(b, p, end)
+	}
+	return p, ErrNoValue
+}
+
 type ParsingMode byte
 
 const (
@@ -1068,45 +3657,253 @@ type decodeOperation struct {
 	mode    ParsingMode
 	done    chan bool
 	desc    jsonStoredProcedure
+	state   *decodeState
+}
+
+// decodeState is shared by every handler in one decode, for the options that need to remember things along the way.
+// It's nil unless one of them is being used, so it costs nothing otherwise
+type decodeState struct {
+	skipMismatches  bool
+	skipper         jsonStoredProcedure
+	disallowUnknown bool
+	collectUnknown  bool
+
+	// where the decode is right now, the first mismatch it skipped, and the unknown keys it found
+	path     []pathStep
+	mismatch *PathError
+	unknown  []*UnknownFieldError
+}
+
+// unknownKey deals with a key at p that doesn't match any field of t, if the decode was asked to,
+// either failing or making a note of it
+func (op decodeOperation) unknownKey(key []byte, t reflect.Type, p int) error {
+	if op.state == nil || !op.state.disallowUnknown && !op.state.collectUnknown {
+		return nil
+	}
+
+	path := []byte{'$'}
+	for _, step := range op.state.path {
+		path = append(path, step.String()...)
+	}
+	path = append(path, keyStep(key)...)
+
+	unknown := &UnknownFieldError{Key: string(key), Type: t, Offset: p, Path: string(path)}
+	if verbose {
+		fmt.Println("found", unknown)
+	}
+	if op.state.disallowUnknown {
+		return unknown
+	}
+	op.state.unknown = append(op.state.unknown, unknown)
+	return nil
+}
+
+// enter and leave keep track of where the decode is, but only if something needs to know
+func (op decodeOperation) enter(step pathStep) {
+	if op.state != nil {
+		op.state.path = append(op.state.path, step)
+	}
+}
+
+func (op decodeOperation) leave() {
+	if op.state != nil {
+		op.state.path = op.state.path[:len(op.state.path)-1]
+	}
+}
+
+// carryOn skips over a value of the wrong type instead of failing, if the decode was asked to, remembering the first one.
+// Anything else comes straight back
+func (op decodeOperation) carryOn(n, end int, err error, t reflect.Type) (int, error) {
+	mismatch, ok := err.(*UnmarshalTypeError)
+	if !ok || op.state == nil || !op.state.skipMismatches {
+		return n, err
+	}
+	if mismatch.Type == nil {
+		mismatch.Type = derefType(t)
+	}
+	if verbose {
+		fmt.Println("skipping", mismatch)
+	}
+
+	if op.state.mismatch == nil {
+		pe := &PathError{Type: t, Err: mismatch}
+		for _, step := range op.state.path {
+			pe.steps = append([]string{step.String()}, pe.steps...)
+			if step.field != "" {
+				pe.fields = append([]string{step.field}, pe.fields...)
+			}
+		}
+		pe.finish()
+		op.state.mismatch = pe
+	}
+
+	skipOp := op
+	skipOp.mode = ModeSkip
+	return op.state.skipper.IntoPointer(skipOp, mismatch.Offset, end, unrealPointer)
+}
+
+// startDetectingCyclesAfter is how many pointers, maps and slices deep an encode goes before it
+// starts remembering them, so values that contain themselves fail instead of running out of stack
+const startDetectingCyclesAfter = 1000
+
+// encodeState is shared by every handler in one encode, to notice when it's gone around in a circle
+type encodeState struct {
+	depth int
+	seen  map[encodeStep]struct{}
+}
+
+// encodeStep is where a pointer, map or slice points, slices also need their length to be the same value
+type encodeStep struct {
+	ptr    uintptr
+	length int
+}
+
+// enter notes that the encode is going through a pointer, map or slice of type t,
+// and fails if that same one is already being encoded further up
+func (e *encodeState) enter(step encodeStep, t reflect.Type) error {
+	e.depth += 1
+	if e.depth <= startDetectingCyclesAfter {
+		return nil
+	}
+	if e.seen == nil {
+		e.seen = make(map[encodeStep]struct{})
+	}
+	if _, found := e.seen[step]; found {
+		return &UnsupportedValueError{Type: t, Reason: "encountered a cycle"}
+	}
+	e.seen[step] = struct{}{}
+	return nil
+}
+
+func (e *encodeState) leave(step encodeStep) {
+	if e.depth > startDetectingCyclesAfter {
+		delete(e.seen, step)
+	}
+	e.depth -= 1
 }
 
-type fastDescribers struct {
+// FastDescribers plans how to decode and encode each type it sees, and keeps those plans to reuse
+type FastDescribers struct {
 	allTypes     sync.Map
 	pendingTypes sync.Map
+	checkedTypes sync.Map
 	lookAheads   chan decodeOperation
+	stop         chan struct{}
+	stopOnce     sync.Once
+
+	useNumber       bool
+	skipMismatches  bool
+	strict          bool
+	disallowUnknown bool
+}
+
+// Option changes how a describer plans to decode, so it has to be given when the describer is created
+type Option func(*FastDescribers)
+
+// UseNumber keeps numbers going into an interface{} as a Number instead of a float64
+func UseNumber() Option {
+	return func(d *FastDescribers) {
+		d.useNumber = true
+	}
+}
+
+// SkipMismatches carries on past values that are the wrong kind for their Go type, leaving them as they were,
+// and returns the first one once everything else has been decoded, the same as encoding/json does
+func SkipMismatches() Option {
+	return func(d *FastDescribers) {
+		d.skipMismatches = true
+	}
+}
+
+// Strict checks the whole input follows RFC 8259 before decoding any of it: only whitespace between tokens,
+// commas where they belong and nowhere else, and nothing after the value. Otherwise decoding is lenient
+func Strict() Option {
+	return func(d *FastDescribers) {
+		d.strict = true
+	}
+}
+
+// DisallowUnknownFields fails the decode at the first key that doesn't match a field of the struct it's in,
+// with an UnknownFieldError. Use UnmarshalWithWarnings instead to find all of them without failing
+func DisallowUnknownFields() Option {
+	return func(d *FastDescribers) {
+		d.disallowUnknown = true
+	}
 }
 
-func newDescriber() *fastDescribers {
-	d := &fastDescribers{lookAheads: make(chan decodeOperation, runtime.NumCPU())}
+// NewDescriber creates a describer with its own cache of plans, separate from the one Unmarshal uses
+func NewDescriber(options ...Option) *FastDescribers {
+	return newDescriber(options...)
+}
+
+func newDescriber(options ...Option) *FastDescribers {
+	d := &FastDescribers{lookAheads: make(chan decodeOperation, runtime.NumCPU()), stop: make(chan struct{})}
+	for _, option := range options {
+		option(d)
+	}
 	d.Store(reflect.TypeOf(map[string]string{}), jsonStringMap{})
 
-	for i := runtime.NumCPU(); i > 0; i-- {
-		go func() {
-			for {
-				op := <-d.lookAheads
-				op.mode = ModeSkip
-				op.desc.IntoPointer(op, 0, len(op.rawData), unrealPointer)
-				close(op.done)
-			}
-		}()
+	if lookAhead {
+		for i := runtime.NumCPU(); i > 0; i-- {
+			go func() {
+				for {
+					select {
+					case op := <-d.lookAheads:
+						op.mode = ModeSkip
+						op.desc.IntoPointer(op, 0, len(op.rawData), unrealPointer)
+						close(op.done)
+					case <-d.stop:
+						return
+					}
+				}
+			}()
+		}
 	}
 
-	in := newJsonInspect()
-	var i []interface{}
-	d.Store(reflect.TypeOf(i).Elem(), in)
+	in := newJsonInspect(d.useNumber)
+	d.Store(interfaceType, in)
 	in.Setup(d)
 
 	return d
 }
 
-func (d *fastDescribers) LearnAbout(t reflect.Type) jsonStoredProcedure {
+// Close stops the goroutines a describer built with the lookahead tag runs alongside each decode.
+// Unmarshal returns ErrClosed after that, but it's safe to Close more than once
+func (d *FastDescribers) Close() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+}
+
+func (d *FastDescribers) LearnAbout(t reflect.Type) jsonStoredProcedure {
 	if t == nil {
-		panic("can't learn about nil type")
+		return newJsonUnsupported(t, "there's nothing to decode into", d)
 	}
 	if verbose {
 		fmt.Println("learning about", t.String())
 	}
 
+	switch t {
+	case typeOfNumber:
+		return jsonNumberText{}
+	case bigIntType, bigFloatType, bigRatType:
+		return jsonBigNumber{numberType: t}
+	case rawValueType:
+		return newJsonRaw(t, d)
+	}
+	if isRawMessage(t) {
+		return newJsonRaw(t, d)
+	}
+
+	if custom := newJsonCustom(t, d); custom != nil {
+		return custom
+	}
+
+	return d.learnKind(t)
+}
+
+// learnKind plans for a type based on nothing but its kind
+func (d *FastDescribers) learnKind(t reflect.Type) jsonStoredProcedure {
 	switch t.Kind() {
 	case reflect.String:
 		return jsonEscapedString{}
@@ -1115,10 +3912,9 @@ func (d *fastDescribers) LearnAbout(t reflect.Type) jsonStoredProcedure {
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		return newJsonNumber(t, d, false, t.Bits())
 	case reflect.Float32, reflect.Float64:
-		panic("floats not handled yet")
-		return newJsonNumber(t, d, true, t.Bits())
+		return newJsonFloat(t, d, t.Bits())
 	case reflect.Bool:
-		panic("bool not handled yet")
+		return jsonBool{}
 	case reflect.Ptr:
 		return newMaybeNull(t, d)
 	case reflect.Map:
@@ -1128,21 +3924,113 @@ func (d *fastDescribers) LearnAbout(t reflect.Type) jsonStoredProcedure {
 	case reflect.Slice:
 		return newJsonArray(t, d)
 	case reflect.Array:
-		panic("array not handled yet")
-		return newJsonArray(t, d)
+		return newJsonFixedArray(t, d)
+	case reflect.Interface:
+		return jsonInterface{
+			ifaceType:   t,
+			unsupported: newJsonUnsupported(t, "only interface{} can be decoded into", d),
+			describer:   d,
+		}
 	default:
-		panic(fmt.Sprintf("unhandled type %s", t.Kind()))
+		return newJsonUnsupported(t, "there's no json for a "+t.Kind().String(), d)
+	}
+}
+
+// jsonInterface is an interface with methods, like error or io.Reader. There's no telling what to create when
+// decoding into one, but whatever it holds can still be written out
+type jsonInterface struct {
+	ifaceType   reflect.Type
+	unsupported jsonUnsupported
+	describer   describer
+}
+
+func (j jsonInterface) ReportPlan(r *jsonReport) {
+	j.unsupported.ReportPlan(r)
+	r.Then(`When writing, write null for a nil %s, or otherwise whatever it holds`, j.ifaceType)
+}
+
+func (j jsonInterface) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
+	return j.unsupported.IntoPointer(op, p, end, base)
+}
+
+func (j jsonInterface) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	iface := reflect.NewAt(j.ifaceType, base).Elem()
+	if iface.IsNil() {
+		return append(b, nullBytes...), nil
+	}
+
+	// the plans only know how to read through pointers, so write a copy of the value it holds
+	val := iface.Elem()
+	if verbose {
+		fmt.Println("inspecting a", val.Type().String(), "held in a", j.ifaceType.String(), "to write it out")
+	}
+	copied := reflect.New(val.Type())
+	reflect.Indirect(copied).Set(val)
+	return j.describer.Describe(val.Type()).FromPointer(e, b, unsafe.Pointer(copied.Pointer()))
+}
+
+// jsonUnsupported stands in for a type that can't be decoded or written, failing only if a value actually turns up for it,
+// so a struct with a channel in it still decodes as long as the json leaves the channel out
+type jsonUnsupported struct {
+	err     *UnsupportedTypeError
+	skipper jsonStoredProcedure
+}
+
+func newJsonUnsupported(t reflect.Type, reason string, des describer) jsonUnsupported {
+	return jsonUnsupported{
+		err:     &UnsupportedTypeError{Type: t, Reason: reason},
+		skipper: des.Describe(interfaceType),
+	}
+}
+
+func (j jsonUnsupported) ReportPlan(r *jsonReport) {
+	if r.err == nil {
+		r.err = j.err
+	}
+	r.Then(`If I get a null, leave the base alone`)
+	r.Then(`Otherwise fail, because of %s`, j.err)
+}
+
+func (j jsonUnsupported) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
+	b := op.rawData
+	if verbose {
+		fmt.Println(fmt.Sprintf("%T", j), "refusing", j.err.Type, "in:", string(b[p:end]))
+	}
+
+	start := peekValue(b, p, end)
+	if start == end {
+		return end, ErrUnexpectedEOF
+	}
+	switch b[start] {
+	case ']':
+		return start, ErrUnexpectedListEnd
+	case '}':
+		return start, ErrUnexpectedMapEnd
+	case 'n':
+		return readNull(b, start, end)
+	}
+	if op.mode == ModeSkip {
+		return j.skipper.IntoPointer(op, start, end, unrealPointer)
 	}
+	return start, j.err
 }
 
-func (d *fastDescribers) Store(t reflect.Type, proc jsonStoredProcedure) {
+func (j jsonUnsupported) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	return b, j.err
+}
+
+func (d *FastDescribers) Store(t reflect.Type, proc jsonStoredProcedure) {
 	if verbose {
-		fmt.Printf("encoder for the %d byte %s = %T\n", t.Size(), t.String(), proc)
+		if t == nil {
+			fmt.Printf("encoder for nothing = %T\n", proc)
+		} else {
+			fmt.Printf("encoder for the %d byte %s = %T\n", t.Size(), t.String(), proc)
+		}
 	}
 	d.allTypes.Store(t, proc)
 }
 
-func (d *fastDescribers) Describe(t reflect.Type) jsonStoredProcedure {
+func (d *FastDescribers) Describe(t reflect.Type) jsonStoredProcedure {
 	use, found := d.allTypes.Load(t)
 	if found {
 		if asProc, ok := use.(jsonStoredProcedure); ok {
@@ -1152,38 +4040,130 @@ func (d *fastDescribers) Describe(t reflect.Type) jsonStoredProcedure {
 		}
 	}
 
-	l := sync.Mutex{}
-	lockIt := sync.NewCond(&l)
-	l.Lock()
-
-	loading, already := d.pendingTypes.LoadOrStore(t, lockIt)
+	plan := &pendingPlan{done: make(chan struct{})}
+	loading, already := d.pendingTypes.LoadOrStore(t, plan)
 	if already {
+		// either the type contains itself, or someone else is learning about it right now.
+		// Waiting would deadlock in the first case, so hand out a plan that looks it up when it's first used
 		if verbose {
-			fmt.Println("waiting for someone to complete", t.String())
+			fmt.Println("deferring until someone completes", t.String())
 		}
-		found := loading.(*sync.Cond)
-		found.Wait()
-		return d.Describe(t)
+		return &jsonLazy{lazyType: t, pending: loading.(*pendingPlan)}
 	}
 
+	// even if learning panics, anyone waiting on this plan has to be let go, and the next describe has to start again
+	defer func() {
+		if plan.proc == nil {
+			plan.proc = newJsonUnsupported(t, "learning about it failed", d)
+		}
+		close(plan.done)
+		d.pendingTypes.Delete(t)
+	}()
+
 	newProc := d.LearnAbout(t)
 	d.Store(t, newProc)
 
-	lockIt.Broadcast()
-	d.pendingTypes.Delete(t)
-
+	plan.proc = newProc
 	return newProc
 }
 
-func (d *fastDescribers) ReportPlan(sample interface{}) jsonReport {
+// pendingPlan is a plan that's still being learned, done is closed once proc is ready
+type pendingPlan struct {
+	done chan struct{}
+	proc jsonStoredProcedure
+}
+
+// jsonLazy stands in for a plan that wasn't finished when it was asked for, which is how recursive types refer to themselves
+type jsonLazy struct {
+	lazyType reflect.Type
+	pending  *pendingPlan
+}
+
+func (j *jsonLazy) resolve() jsonStoredProcedure {
+	<-j.pending.done
+	return j.pending.proc
+}
+
+func (j *jsonLazy) ReportPlan(r *jsonReport) {
+	r.Then(`Decode the %s the same way as before (recursive, see above)`, j.lazyType)
+}
+
+func (j *jsonLazy) IntoPointer(op decodeOperation, p, end int, base unsafe.Pointer) (int, error) {
+	return j.resolve().IntoPointer(op, p, end, base)
+}
+
+func (j *jsonLazy) FromPointer(e *encodeState, b []byte, base unsafe.Pointer) ([]byte, error) {
+	return j.resolve().FromPointer(e, b, base)
+}
+
+func (d *FastDescribers) ReportPlan(sample interface{}) jsonReport {
 	j := &jsonReport{}
 	j.Then("Here's how I plan to decode %T", sample)
 	des := d.Describe(reflect.TypeOf(sample))
+	if lazy, ok := des.(*jsonLazy); ok {
+		// someone else was learning it at the same time, so it isn't really recursive
+		des = lazy.resolve()
+	}
 	des.ReportPlan(j)
 	return *j
 }
 
-func (d *fastDescribers) Unmarshal(b []byte, to interface{}) error {
+// CheckType finds the first part of sample's type that can't be decoded or written, so you can catch them in tests
+// instead of waiting for a value to turn up for them. It only has to look once per type
+func (d *FastDescribers) CheckType(sample interface{}) error {
+	t := reflect.TypeOf(sample)
+	if checked, found := d.checkedTypes.Load(t); found {
+		if checked == nil {
+			return nil
+		}
+		return checked.(error)
+	}
+
+	var err error
+	if report := d.ReportPlan(sample); report.err != nil {
+		err = report.err
+	}
+	d.checkedTypes.Store(t, err)
+	return err
+}
+
+func (d *FastDescribers) Unmarshal(b []byte, to interface{}) error {
+	_, err := d.unmarshal(b, to, false)
+	return err
+}
+
+// UnmarshalWithWarnings is like Unmarshal, but also gives back every key that didn't match a field,
+// instead of quietly skipping over them
+func (d *FastDescribers) UnmarshalWithWarnings(b []byte, to interface{}) ([]*UnknownFieldError, error) {
+	state, err := d.unmarshal(b, to, true)
+	if state == nil {
+		return nil, err
+	}
+	return state.unknown, err
+}
+
+// newState only creates a decodeState if one of the options needs it
+func (d *FastDescribers) newState(collectUnknown bool) *decodeState {
+	if !d.skipMismatches && !d.disallowUnknown && !collectUnknown {
+		return nil
+	}
+	return &decodeState{
+		skipMismatches:  d.skipMismatches,
+		skipper:         d.Describe(interfaceType),
+		disallowUnknown: d.disallowUnknown,
+		collectUnknown:  collectUnknown,
+	}
+}
+
+func (d *FastDescribers) unmarshal(b []byte, to interface{}, collectUnknown bool) (*decodeState, error) {
+	if to == nil {
+		return nil, ErrNotPointer
+	}
+	select {
+	case <-d.stop:
+		return nil, ErrClosed
+	default:
+	}
 	v := reflect.ValueOf(to)
 	t := v.Type()
 
@@ -1192,13 +4172,25 @@ func (d *fastDescribers) Unmarshal(b []byte, to interface{}) error {
 		fmt.Printf("given %#v\n", v.Interface())
 	}
 
+	if d.strict {
+		if n, err := scanDocument(b); err != nil {
+			return nil, newSyntaxError(b, n, err)
+		}
+	}
+
 	desc := d.Describe(t)
 
 	op := decodeOperation{desc: desc, rawData: b, mode: ModeAlloc}
 	if lookAhead {
 		op.done = make(chan bool)
-		d.lookAheads <- op
+		// Close might still happen while this waits for room, and then nothing would ever take it
+		select {
+		case d.lookAheads <- op:
+		case <-d.stop:
+			return nil, ErrClosed
+		}
 	}
+	op.state = d.newState(collectUnknown)
 
 	if !dryRun {
 		// create a pointer to whatever i've been given
@@ -1210,16 +4202,63 @@ func (d *fastDescribers) Unmarshal(b []byte, to interface{}) error {
 			fmt.Printf("setup> got a %s going in to a %s\n", v.String(), ch.String())
 		}
 		reflect.Indirect(indirect).Set(v)
-		_, err := desc.IntoPointer(op, 0, len(b), unsafe.Pointer(indirect.Pointer()))
+		n, err := desc.IntoPointer(op, 0, len(b), unsafe.Pointer(indirect.Pointer()))
 		if err != nil {
-			return err
+			pe, inside := err.(*PathError)
+			if inside {
+				err = pe.Err
+			}
+			if syntaxErrors[err] {
+				err = newSyntaxError(b, n, err)
+			}
+			if inside {
+				pe.Err = err
+				pe.finish()
+				return op.state, pe
+			}
+			if mismatch, ok := err.(*UnmarshalTypeError); ok && mismatch.Type == nil {
+				mismatch.Type = derefType(t)
+			}
+			return op.state, err
+		}
+		if op.state != nil && op.state.mismatch != nil {
+			return op.state, op.state.mismatch
 		}
 	}
 
 	if lookAhead {
-		<-op.done
+		// if Close stopped the lookaheads before one got to this, there's nothing to wait for
+		select {
+		case <-op.done:
+		case <-d.stop:
+		}
 	}
-	return nil
+	return op.state, nil
+}
+
+func (d *FastDescribers) Marshal(from interface{}) ([]byte, error) {
+	if from == nil {
+		return append([]byte(nil), nullBytes...), nil
+	}
+
+	v := reflect.ValueOf(from)
+	t := v.Type()
+
+	if verbose {
+		fmt.Println("marshal called with", v.String())
+	}
+
+	desc := d.Describe(t)
+
+	// the plans only know how to read through pointers, so give it one
+	indirect := reflect.New(t)
+	reflect.Indirect(indirect).Set(v)
+	b, err := desc.FromPointer(&encodeState{}, make([]byte, 0, 64), unsafe.Pointer(indirect.Pointer()))
+	if err != nil {
+		// whatever was written before the failure isn't json, so don't hand it back
+		return nil, err
+	}
+	return b, nil
 }
 
 var standard = newDescriber()
@@ -1228,6 +4267,32 @@ func Unmarshal(b []byte, to interface{}) error {
 	return standard.Unmarshal(b, to)
 }
 
+func UnmarshalWithWarnings(b []byte, to interface{}) ([]*UnknownFieldError, error) {
+	return standard.UnmarshalWithWarnings(b, to)
+}
+
+func Marshal(from interface{}) ([]byte, error) {
+	return standard.Marshal(from)
+}
+
 func ReportPlan(of interface{}) jsonReport {
 	return standard.ReportPlan(of)
 }
+
+func CheckType(sample interface{}) error {
+	return standard.CheckType(sample)
+}
+
+// Valid reports whether b is exactly one json value following RFC 8259, without decoding any of it
+func Valid(b []byte) bool {
+	_, err := scanDocument(b)
+	return err == nil
+}
+
+// Validate is like Valid, but says where the first problem is with a SyntaxError
+func Validate(b []byte) error {
+	if n, err := scanDocument(b); err != nil {
+		return newSyntaxError(b, n, err)
+	}
+	return nil
+}
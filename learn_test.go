@@ -1,12 +1,21 @@
 package json
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/json-iterator/go"
 	"github.com/mailru/easyjson"
 	"github.com/zuoxinyu/jzon"
+	"io"
+	"math/big"
+	"net"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 var str = []byte(`  { 
@@ -61,13 +70,1288 @@ func TestNumberInt(t *testing.T) {
 	t.Log(ReportPlan(&i))
 
 	t.Logf("before: %d", i)
-	Unmarshal(iData, &i)
+	if err := Unmarshal(iData, &i); err != nil {
+		t.Error(err)
+	}
 	t.Logf("want 100, got %d", i)
 	if i != 100 {
 		t.Fail()
 	}
 }
 
+type numberType struct {
+	Small  int8
+	Medium uint16
+	Large  int64
+	Huge   uint64
+	Normal int
+	Many   []int32
+	Byte   uint8
+	Word   uint32
+}
+
+func TestNumberWidths(t *testing.T) {
+	src := []byte(`{"Small": -128, "Medium": 65535, "Large": -9223372036854775808,
+		"Huge": 18446744073709551615, "Normal": 42, "Many": [1, -2 , 3], "Byte": 255, "Word": 4294967295}`)
+
+	var mine, theirs numberType
+	if err := Unmarshal(src, &mine); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(src, &theirs)
+	t.Logf("mine: %#v", mine)
+	if !reflect.DeepEqual(mine, theirs) {
+		t.Errorf("different outcomes, theirs: %#v", theirs)
+	}
+
+	for _, bad := range []string{`{"Small": 128}`, `{"Medium": -1}`, `{"Huge": 18446744073709551616}`, `{"Normal": 1.5}`, `{"Normal": -}`,
+		`{"Byte": 300}`, `{"Medium": 70000}`, `{"Word": 4294967296}`} {
+		var dst numberType
+		if err := Unmarshal([]byte(bad), &dst); err == nil {
+			t.Errorf("%s should not have decoded, got %#v", bad, dst)
+		}
+	}
+}
+
+type floatType struct {
+	Single float32
+	Double float64
+}
+
+func TestFloats(t *testing.T) {
+	literals := []string{
+		"0", "-0", "1", "-1.5", "3.141592653589793", "1e10", "1E-7", "2.5e+3", "123456789012345678901234567890",
+		"0.1", "0.30000000000000004", "1.7976931348623157e308", "4.9406564584124654e-324", "1e-400",
+		"9007199254740993", "0.000001", "1e21", "16777217", "3.4028234663852886e38", "1.401298464324817e-45",
+	}
+	for _, l := range literals {
+		src := []byte(`{"Single": ` + l + `, "Double": ` + l + `}`)
+		var mine, theirs floatType
+		err := Unmarshal(src, &mine)
+		err2 := json.Unmarshal(src, &theirs)
+		if (err == nil) != (err2 == nil) {
+			t.Errorf("%s: mine %v, theirs %v", l, err, err2)
+		}
+		if err != nil {
+			continue
+		}
+		if mine != theirs {
+			t.Errorf("%s: mine %#v, theirs %#v", l, mine, theirs)
+		}
+
+		mineOut, err := Marshal(mine)
+		if err != nil {
+			t.Error(err)
+		}
+		theirsOut, _ := json.Marshal(theirs)
+		if string(mineOut) != string(theirsOut) {
+			t.Errorf("%s: wrote %s, expected %s", l, mineOut, theirsOut)
+		}
+	}
+
+	for _, bad := range []string{`{"Double": 1e400}`, `{"Double": 1.}`, `{"Double": -}`, `{"Single": 1e39}`, `{"Double": 1e}`} {
+		var dst floatType
+		if err := Unmarshal([]byte(bad), &dst); err == nil {
+			t.Errorf("%s should not have decoded, got %#v", bad, dst)
+		}
+	}
+}
+
+type boolType struct {
+	Yes  bool
+	No   bool
+	Name string
+	Many []bool
+}
+
+func TestBools(t *testing.T) {
+	src := []byte(`{"Yes": true, "unknown": false, "No": false, "other": [true, {"deep": true}],
+		"Many": [true,false , true], "Name": "after"}`)
+
+	mine := boolType{No: true}
+	theirs := boolType{No: true}
+	if err := Unmarshal(src, &mine); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(src, &theirs)
+	t.Logf("mine: %#v", mine)
+	if !reflect.DeepEqual(mine, theirs) {
+		t.Errorf("different outcomes, theirs: %#v", theirs)
+	}
+
+	var anything interface{}
+	if err := Unmarshal([]byte(`[true, "x", false]`), &anything); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(anything, []interface{}{true, "x", false}) {
+		t.Errorf("got %#v", anything)
+	}
+
+	out, _ := Marshal(mine)
+	theirsOut, _ := json.Marshal(theirs)
+	if string(out) != string(theirsOut) {
+		t.Errorf("wrote %s, expected %s", out, theirsOut)
+	}
+
+	for _, bad := range []string{`{"Yes": tru}`, `{"Yes": falsey}`, `{"Yes": t}`} {
+		var dst boolType
+		if err := Unmarshal([]byte(bad), &dst); err == nil {
+			t.Errorf("%s should not have decoded, got %#v", bad, dst)
+		}
+	}
+}
+
+type nullType struct {
+	Name     string
+	Count    int
+	Ratio    float64
+	Yes      bool
+	Nested   *nested
+	Value    nested
+	List     []string
+	Numbers  []int
+	Tags     map[string]string
+	Lookup   map[string]int
+	Anything interface{}
+}
+
+func TestNulls(t *testing.T) {
+	src := []byte(`{"Name": null, "Count": null, "Ratio": null, "Yes": null, "Nested": null, "Value": null,
+		"List": null, "Numbers": [1, null, 3], "Tags": null, "Lookup": null, "Anything": null,
+		"unknown": null, "skipped": {"a": null, "b": [null, {"c": null}]}}`)
+
+	fill := func() nullType {
+		return nullType{
+			Name: "name", Count: 1, Ratio: 0.5, Yes: true, Nested: &nested{Amazing: "a"}, Value: nested{Amazing: "b"},
+			List: []string{"x"}, Tags: map[string]string{"a": "b"}, Lookup: map[string]int{"a": 1}, Anything: "something",
+		}
+	}
+
+	mine, theirs := fill(), fill()
+	if err := Unmarshal(src, &mine); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(src, &theirs)
+	t.Logf("mine: %#v", mine)
+	if !reflect.DeepEqual(mine, theirs) {
+		t.Errorf("different outcomes, theirs: %#v", theirs)
+	}
+
+	var anything interface{}
+	if err := Unmarshal([]byte(`{"a": null, "b": [null]}`), &anything); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(anything, map[string]interface{}{"a": nil, "b": []interface{}{nil}}) {
+		t.Errorf("got %#v", anything)
+	}
+
+	for _, bad := range []string{`{"Name": nul}`, `{"Nested": nulls}`, `{"List": nil}`} {
+		dst := fill()
+		if err := Unmarshal([]byte(bad), &dst); err == nil {
+			t.Errorf("%s should not have decoded, got %#v", bad, dst)
+		}
+	}
+}
+
+func TestEscapedStrings(t *testing.T) {
+	for _, s := range []string{
+		`"plain"`, `"say \"hi\""`, `"tab\there\nnewline"`, `"back\\slash and \/ slash"`,
+		`"\u00e9t\u00E9"`, `"\ud83d\ude00 smile"`, `"lone \ud83d surrogate"`, `"\b\f\r"`, `"caf\u00e9 after plain"`,
+		`"\udc00 backwards"`, `"\ud83d\u0041 broken pair"`,
+	} {
+		var mine, theirs string
+		if err := Unmarshal([]byte(s), &mine); err != nil {
+			t.Errorf("%s: %s", s, err)
+			continue
+		}
+		json.Unmarshal([]byte(s), &theirs)
+		if mine != theirs {
+			t.Errorf("%s: mine %#v, theirs %#v", s, mine, theirs)
+		}
+	}
+
+	var obj simpleType
+	if err := Unmarshal([]byte(`{"unknown": "skip \"this\"}", "Name": "a\"b"}`), &obj); err != nil {
+		t.Error(err)
+	}
+	if obj.Name != `a"b` {
+		t.Errorf("got %#v", obj.Name)
+	}
+
+	for _, bad := range []string{`"bad \x escape"`, `"bad \u12 escape"`, "\"raw\ttab\"", "\"raw\nnewline\"", `"unfinished \`} {
+		var dst string
+		if err := Unmarshal([]byte(bad), &dst); err == nil {
+			t.Errorf("%s should not have decoded, got %#v", bad, dst)
+		}
+	}
+}
+
+type taggedType struct {
+	UserID   int    `json:"user_id"`
+	Secret   string `json:"-"`
+	Nickname string `json:",omitempty"`
+	Email    string `json:"email,omitempty"`
+	Dash     string `json:"-,"`
+	Plain    string
+}
+
+func TestStructTags(t *testing.T) {
+	src := []byte(`{"user_id": 7, "Secret": "nope", "Nickname": "nick", "EMAIL": "a@b", "-": "dash", "plain": "p", "UserID": "8"}`)
+
+	var mine, theirs taggedType
+	if err := Unmarshal(src, &mine); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(src, &theirs)
+	t.Logf("mine: %#v", mine)
+	if !reflect.DeepEqual(mine, theirs) {
+		t.Errorf("different outcomes, theirs: %#v", theirs)
+	}
+
+	for _, v := range []taggedType{mine, {UserID: 1, Secret: "s"}} {
+		out, err := Marshal(v)
+		if err != nil {
+			t.Error(err)
+		}
+		theirsOut, _ := json.Marshal(v)
+		if string(out) != string(theirsOut) {
+			t.Errorf("wrote %s, expected %s", out, theirsOut)
+		}
+	}
+
+	plan := ReportPlan(&mine).String()
+	t.Log(plan)
+	if !strings.Contains(plan, `"user_id" (the tag on UserID)`) || !strings.Contains(plan, `"email" (the tag on Email, with omitempty)`) {
+		t.Error("tags aren't in the plan")
+	}
+	if strings.Contains(plan, `"Secret"`) {
+		t.Error("ignored field is in the plan")
+	}
+}
+
+type embeddedUser struct {
+	ID   int
+	Name string `json:"name"`
+}
+
+type EmbeddedAudit struct {
+	Created string
+	Name    string
+	ID      int `json:"ID"`
+}
+
+type embeddedAdmin struct {
+	embeddedUser
+	*EmbeddedAudit
+	Level int
+}
+
+type embeddedTwice struct {
+	Left
+	Right
+	Level int
+}
+
+type Left struct {
+	Shared   string
+	OnlyLeft string
+}
+
+type Right struct {
+	Shared    string
+	OnlyRight string
+}
+
+func TestEmbedded(t *testing.T) {
+	src := []byte(`{"ID": 4, "name": "dan", "Name": "dan too", "Created": "today", "Level": 9}`)
+
+	var mine, theirs embeddedAdmin
+	if err := Unmarshal(src, &mine); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(src, &theirs)
+	t.Logf("mine: %#v, %#v", mine, mine.EmbeddedAudit)
+	if !reflect.DeepEqual(mine, theirs) {
+		t.Errorf("different outcomes, theirs: %#v, %#v", theirs, theirs.EmbeddedAudit)
+	}
+
+	for _, v := range []interface{}{mine, embeddedAdmin{Level: 1}, embeddedTwice{Left{"l", "l"}, Right{"r", "r"}, 2}} {
+		out, err := Marshal(v)
+		if err != nil {
+			t.Error(err)
+		}
+		theirsOut, _ := json.Marshal(v)
+		if string(out) != string(theirsOut) {
+			t.Errorf("wrote %s, expected %s", out, theirsOut)
+		}
+	}
+
+	twice := []byte(`{"Shared": "nobody", "OnlyLeft": "l", "OnlyRight": "r", "Level": 3}`)
+	var mineTwice, theirsTwice embeddedTwice
+	if err := Unmarshal(twice, &mineTwice); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(twice, &theirsTwice)
+	if !reflect.DeepEqual(mineTwice, theirsTwice) {
+		t.Errorf("different outcomes, mine: %#v, theirs: %#v", mineTwice, theirsTwice)
+	}
+
+	plan := ReportPlan(&mine).String()
+	t.Log(plan)
+	if !strings.Contains(plan, `"Created" (promoted from EmbeddedAudit)`) {
+		t.Error("promoted fields aren't in the plan")
+	}
+}
+
+type hiddenInt int
+
+type VisibleInt int
+
+type hiddenStruct struct {
+	Promoted string
+	private  string
+}
+
+type unexportedType struct {
+	hiddenStruct
+	hiddenInt
+	VisibleInt
+	Name   string
+	secret string
+}
+
+type unexportedPointer struct {
+	*hiddenStruct
+	Name string
+}
+
+func TestUnexported(t *testing.T) {
+	src := []byte(`{"Promoted": "p", "private": "x", "hiddenInt": "1", "VisibleInt": 2, "Name": "n", "secret": "s"}`)
+
+	var mine, theirs unexportedType
+	if err := Unmarshal(src, &mine); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(src, &theirs)
+	t.Logf("mine: %#v", mine)
+	if !reflect.DeepEqual(mine, theirs) {
+		t.Errorf("different outcomes, theirs: %#v", theirs)
+	}
+
+	mine.secret, mine.private = "still secret", "still private"
+	out, _ := Marshal(mine)
+	theirsOut, _ := json.Marshal(mine)
+	if string(out) != string(theirsOut) {
+		t.Errorf("wrote %s, expected %s", out, theirsOut)
+	}
+
+	var missing unexportedPointer
+	if err := Unmarshal([]byte(`{"Name": "n", "Promoted": "p"}`), &missing); err == nil || missing.hiddenStruct != nil {
+		t.Errorf("created an unexported embedded pointer: %#v", missing)
+	}
+
+	present := unexportedPointer{hiddenStruct: &hiddenStruct{}}
+	if err := Unmarshal([]byte(`{"Name": "n", "Promoted": "p"}`), &present); err != nil || present.Promoted != "p" {
+		t.Errorf("didn't fill an existing embedded pointer: %#v, %s", present, err)
+	}
+}
+
+type arrayType struct {
+	Point [3]float64
+	ID    [16]byte
+	Grid  [2][2]int
+	Names [2]string
+	Empty [0]int
+}
+
+func TestFixedArrays(t *testing.T) {
+	for _, src := range [][]byte{
+		[]byte(`{"Point": [1.5, -2, 3e2], "ID": [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16], "Grid": [[1, 2], [3, 4]], "Names": ["a", "b"]}`),
+		[]byte(`{"Point": [1], "ID": [], "Grid": [[1], [2, 3, 4]], "Names": ["a", "b", "c", {"d": ["e"]}], "Empty": [1, 2]}`),
+		[]byte(`{"Point": null, "Grid": [null, [5, 6]], "Names": [null, "z"]}`),
+		[]byte(`{"Names": ["a", "b", {"d": ["e"]}, [1, {"f": 2}]], "Point": [1, 2, 3], "Grid": [[1, 2], [3, 4], {"g": [5]}], "ID": [7]}`),
+	} {
+		fill := func() arrayType {
+			return arrayType{Point: [3]float64{9, 9, 9}, ID: [16]byte{9, 9}, Grid: [2][2]int{{9, 9}, {9, 9}}, Names: [2]string{"9", "9"}}
+		}
+		mine, theirs := fill(), fill()
+		if err := Unmarshal(src, &mine); err != nil {
+			t.Fatal(err)
+		}
+		json.Unmarshal(src, &theirs)
+		t.Logf("mine: %#v", mine)
+		if !reflect.DeepEqual(mine, theirs) {
+			t.Errorf("different outcomes, theirs: %#v", theirs)
+		}
+
+		out, _ := Marshal(mine)
+		theirsOut, _ := json.Marshal(mine)
+		if string(out) != string(theirsOut) {
+			t.Errorf("wrote %s, expected %s", out, theirsOut)
+		}
+	}
+}
+
+type quotedType struct {
+	ID      int64    `json:"id,string"`
+	Ratio   float64  `json:",string"`
+	OK      bool     `json:",string"`
+	Maybe   *uint8   `json:",string"`
+	Nothing *int     `json:",string"`
+	Name    string   `json:"name"`
+	List    []int    `json:",string"`
+	Skipped struct{} `json:",string"`
+}
+
+func TestQuotedOption(t *testing.T) {
+	src := []byte(`{"id": "12345", "Ratio": "-1.5e2", "OK": "true", "Maybe": "7", "Nothing": null, "name": "n", "List": [1, 2]}`)
+
+	var mine, theirs quotedType
+	if err := Unmarshal(src, &mine); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(src, &theirs)
+	t.Logf("mine: %#v", mine)
+	if !reflect.DeepEqual(mine, theirs) {
+		t.Errorf("different outcomes, theirs: %#v", theirs)
+	}
+
+	out, _ := Marshal(mine)
+	theirsOut, _ := json.Marshal(mine)
+	if string(out) != string(theirsOut) {
+		t.Errorf("wrote %s, expected %s", out, theirsOut)
+	}
+
+	plan := ReportPlan(&mine).String()
+	if !strings.Contains(plan, `Find the closing ", then inside the quotes:`) {
+		t.Error("quoting isn't in the plan")
+	}
+
+	for _, bad := range []string{`{"id": 12345}`, `{"id": "12x"}`, `{"id": " 12"}`, `{"OK": "yes"}`, `{"id": ""}`} {
+		var dst quotedType
+		if err := Unmarshal([]byte(bad), &dst); err == nil {
+			t.Errorf("%s should not have decoded, got %#v", bad, dst)
+		}
+	}
+}
+
+type colour int
+
+func (c *colour) UnmarshalJSON(b []byte) error {
+	switch string(b) {
+	case `"red"`:
+		*c = 1
+	case `"green"`:
+		*c = 2
+	case `null`:
+	default:
+		return fmt.Errorf("unknown colour %s", b)
+	}
+	return nil
+}
+
+func (c colour) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"colour %d"`, int(c))), nil
+}
+
+type rawOutput string
+
+func (r rawOutput) MarshalJSON() ([]byte, error) {
+	return []byte(r), nil
+}
+
+type upperText string
+
+func (u *upperText) UnmarshalText(b []byte) error {
+	*u = upperText(strings.ToUpper(string(b)))
+	return nil
+}
+
+type customType struct {
+	When    time.Time
+	Later   *time.Time
+	Address net.IP
+	Colour  colour
+	Colours []colour
+	Shout   upperText
+	Deep    map[string]colour
+}
+
+func TestCustomMethods(t *testing.T) {
+	src := []byte(`{"When": "2020-01-02T03:04:05Z", "Later": "2021-06-07T08:09:10.5+02:00", "Address": "10.0.0.1",
+		"Colour": "red", "Colours": ["green", null, "red"], "Shout": "quiet \u0021", "Deep": {"a": "green"}}`)
+
+	var mine, theirs customType
+	if err := Unmarshal(src, &mine); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(src, &theirs)
+	t.Logf("mine: %#v", mine)
+	if !reflect.DeepEqual(mine, theirs) {
+		t.Errorf("different outcomes, theirs: %#v", theirs)
+	}
+
+	out, _ := Marshal(mine)
+	theirsOut, _ := json.Marshal(mine)
+	if string(out) != string(theirsOut) {
+		t.Errorf("wrote %s, expected %s", out, theirsOut)
+	}
+
+	for _, out := range []rawOutput{``, `{`, `"a" "b"`, `[1,]`, `nope`} {
+		_, err := Marshal(map[string]rawOutput{"x": out})
+		_, err2 := json.Marshal(map[string]rawOutput{"x": out})
+		var marshalErr *MarshalerError
+		if !errors.As(err, &marshalErr) || marshalErr.Type != reflect.TypeOf(out) || err2 == nil {
+			t.Errorf("MarshalJSON gave %q, got %v, theirs %v", out, err, err2)
+		}
+	}
+
+	var bad customType
+	if err := Unmarshal([]byte(`{"Colour": "blue"}`), &bad); err == nil || !strings.Contains(err.Error(), "unknown colour") {
+		t.Errorf("UnmarshalJSON error got lost: %v", err)
+	}
+	if err := Unmarshal([]byte(`{"When": 12}`), &bad); err == nil {
+		t.Error("decoded a number with UnmarshalText")
+	}
+
+	plan := ReportPlan(&mine).String()
+	if !strings.Contains(plan, `(*json.colour).UnmarshalJSON`) || !strings.Contains(plan, `(*time.Time).UnmarshalJSON`) {
+		t.Error("custom methods aren't in the plan")
+	}
+}
+
+type envelopeType struct {
+	Kind    string
+	Body    RawMessage
+	Later   json.RawMessage
+	Aliased RawValue
+	Many    []RawMessage
+}
+
+func TestRawMessages(t *testing.T) {
+	src := []byte(`{"Kind": "order", "Body": {"id": [1, 2, {"x": "}"}]}, "Later": "text \" ]",
+		"Aliased": -12.5e3, "Many": [true, null, [], "a"]}`)
+
+	var mine envelopeType
+	if err := Unmarshal(src, &mine); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("mine: %s | %s | %s | %s", mine.Body, mine.Later, mine.Aliased, mine.Many)
+
+	var theirs struct {
+		Kind    string
+		Body    json.RawMessage
+		Later   json.RawMessage
+		Aliased json.RawMessage
+		Many    []json.RawMessage
+	}
+	json.Unmarshal(src, &theirs)
+	if mine.Kind != theirs.Kind || string(mine.Body) != string(theirs.Body) || string(mine.Later) != string(theirs.Later) ||
+		string(mine.Aliased) != string(theirs.Aliased) || len(mine.Many) != len(theirs.Many) {
+		t.Errorf("different outcomes, theirs: %s | %s | %s | %s", theirs.Body, theirs.Later, theirs.Aliased, theirs.Many)
+	}
+	for i := range theirs.Many {
+		if i < len(mine.Many) && string(mine.Many[i]) != string(theirs.Many[i]) {
+			t.Errorf("element %d is %s, expected %s", i, mine.Many[i], theirs.Many[i])
+		}
+	}
+
+	// the copy should survive changes to the input, the alias shouldn't
+	copy(src, bytes.Repeat([]byte{'#'}, len(src)))
+	if string(mine.Body) != `{"id": [1, 2, {"x": "}"}]}` {
+		t.Errorf("RawMessage wasn't copied: %s", mine.Body)
+	}
+	if string(mine.Aliased) != `#######` {
+		t.Errorf("RawValue wasn't aliased: %s", mine.Aliased)
+	}
+
+	out, err := Marshal(envelopeType{Kind: "x", Body: RawMessage(`{"a":1}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"Kind":"x","Body":{"a":1},"Later":null,"Aliased":null,"Many":null}` {
+		t.Errorf("wrote %s", out)
+	}
+}
+
+type pointKey struct {
+	X, Y int
+}
+
+func (k *pointKey) UnmarshalText(b []byte) error {
+	_, err := fmt.Sscanf(string(b), "%d,%d", &k.X, &k.Y)
+	return err
+}
+
+func (k pointKey) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d,%d", k.X, k.Y)), nil
+}
+
+type userID int16
+
+type keyedType struct {
+	ByInt    map[int]string
+	ByUint8  map[uint8]bool
+	ByID     map[userID]float64
+	ByPoint  map[pointKey]string
+	ByString map[string]int
+}
+
+func TestMapKeys(t *testing.T) {
+	src := []byte(`{"ByInt": {"-3": "a", "10": "b", "2": "c"}, "ByUint8": {"255": true, "0": false},
+		"ByID": {"7": 1.5}, "ByPoint": {"1,2": "here", "-4,5": "there"}, "ByString": {"x": 1}}`)
+
+	var mine, theirs keyedType
+	if err := Unmarshal(src, &mine); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(src, &theirs)
+	t.Logf("mine: %#v", mine)
+	if !reflect.DeepEqual(mine, theirs) {
+		t.Errorf("different outcomes, theirs: %#v", theirs)
+	}
+
+	out, _ := Marshal(mine)
+	theirsOut, _ := json.Marshal(mine)
+	if string(out) != string(theirsOut) {
+		t.Errorf("wrote %s, expected %s", out, theirsOut)
+	}
+
+	var bad keyedType
+	for _, src := range []string{`{"ByUint8": {"256": true}}`, `{"ByInt": {"1.5": "a"}}`, `{"ByInt": {"": "a"}}`, `{"ByPoint": {"x": "a"}}`} {
+		if err := Unmarshal([]byte(src), &bad); err == nil {
+			t.Errorf("accepted a bad key in %s", src)
+		}
+	}
+
+	// escaped keys are unescaped, both for map[string]string and for other string keyed maps
+	escaped := []byte(`{"a\"b": "1", "c\\d": "2", "\u00e9": "3"}`)
+	var strs, strsTheirs map[string]string
+	err := Unmarshal(escaped, &strs)
+	json.Unmarshal(escaped, &strsTheirs)
+	if err != nil || !reflect.DeepEqual(strs, strsTheirs) {
+		t.Errorf("got %#v, %v, theirs: %#v", strs, err, strsTheirs)
+	}
+
+	counts := map[string]int{"a\"b": 1, "<&>": 2}
+	written, _ := Marshal(counts)
+	var back map[string]int
+	if err := Unmarshal(written, &back); err != nil || !reflect.DeepEqual(back, counts) {
+		t.Errorf("%s came back as %#v, %v", written, back, err)
+	}
+
+	var keyErr *UnsupportedTypeError
+	if err := CheckType(map[[2]int]string{}); !errors.As(err, &keyErr) {
+		t.Errorf("described a map with an unsupported key type, got %v", err)
+	}
+}
+
+type treeNode struct {
+	Name     string
+	Children []*treeNode
+	Parent   *treeNode `json:",omitempty"`
+}
+
+type listNode struct {
+	Value int
+	Next  *listNode
+}
+
+type pingType struct {
+	Pong *pongType
+}
+
+type pongType struct {
+	Pings []pingType
+	Named map[string]pongType
+}
+
+type dirNode struct {
+	Name  string
+	Files map[string]*dirNode
+	Sizes map[string]map[string]int
+}
+
+type recursiveType struct {
+	Tree  treeNode
+	List  *listNode
+	Ping  pingType
+	Trees []treeNode
+	Dir   dirNode
+}
+
+func TestRecursiveTypes(t *testing.T) {
+	src := []byte(`{"Tree": {"Name": "root", "Children": [{"Name": "a", "Children": [{"Name": "b"}]}, null]},
+		"List": {"Value": 1, "Next": {"Value": 2, "Next": {"Value": 3, "Next": null}}},
+		"Ping": {"Pong": {"Pings": [{"Pong": {"Named": {"x": {"Pings": []}}}}, {}]}},
+		"Trees": [{"Name": "other"}],
+		"Dir": {"Files": {"a": {"Name": "a", "Files": {"x": {"Name": "x"}}}, "b": {"Name": "b"}, "c": null},
+			"Sizes": {"p": {"one": 1}, "q": {"two": 2}}}}`)
+
+	var mine, theirs recursiveType
+	if err := Unmarshal(src, &mine); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(src, &theirs)
+	if !reflect.DeepEqual(mine, theirs) {
+		t.Errorf("different outcomes, mine: %#v theirs: %#v", mine, theirs)
+	}
+
+	out, _ := Marshal(mine)
+	theirsOut, _ := json.Marshal(mine)
+	if string(out) != string(theirsOut) {
+		t.Errorf("wrote %s, expected %s", out, theirsOut)
+	}
+
+	plan := ReportPlan(&mine).String()
+	t.Log(plan)
+	if !strings.Contains(plan, "(recursive, see above)") {
+		t.Error("plan doesn't mention the recursion")
+	}
+
+	// lots of fresh describers learning the same recursive types at once shouldn't get stuck
+	done := make(chan bool)
+	for i := 0; i < 8; i++ {
+		d := NewDescriber()
+		for j := 0; j < 4; j++ {
+			go func() {
+				var dst recursiveType
+				done <- d.Unmarshal(src, &dst) == nil && reflect.DeepEqual(dst, theirs)
+			}()
+		}
+	}
+	for i := 0; i < 32; i++ {
+		select {
+		case ok := <-done:
+			if !ok {
+				t.Error("concurrent describe decoded differently")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("describing recursive types got stuck")
+		}
+	}
+
+	// values that contain themselves can't be written, but long ones that don't are fine
+	loop := &listNode{Value: 1}
+	loop.Next = loop
+	m := map[string]interface{}{}
+	m["m"] = m
+	s := []interface{}{nil}
+	s[0] = s
+	for _, v := range []interface{}{loop, m, s} {
+		_, err := Marshal(v)
+		_, err2 := json.Marshal(v)
+		var valueErr *UnsupportedValueError
+		if !errors.As(err, &valueErr) || err2 == nil {
+			t.Errorf("wrote a cycle in %T, got %v, theirs %v", v, err, err2)
+		}
+	}
+
+	long := &listNode{}
+	for i := 0; i < 1500; i++ {
+		long = &listNode{Value: i, Next: long}
+	}
+	out, err := Marshal(long)
+	theirsOut, _ = json.Marshal(long)
+	if err != nil || string(out) != string(theirsOut) {
+		t.Errorf("couldn't write a long list: %v", err)
+	}
+}
+
+type describerHolder struct {
+	describers []*FastDescribers
+}
+
+func TestDescriberClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	var h describerHolder
+	for i := 0; i < 4; i++ {
+		d := NewDescriber()
+		var dst testType
+		if err := d.Unmarshal(str, &dst); err != nil {
+			t.Fatal(err)
+		}
+		h.describers = append(h.describers, d)
+	}
+	for _, d := range h.describers {
+		d.Close()
+		d.Close()
+	}
+
+	// decoding afterwards fails straight away instead of waiting on goroutines that are gone
+	done := make(chan error)
+	go func() {
+		var dst testType
+		for i := 0; i < 2*runtime.NumCPU()+1; i++ {
+			if err := h.describers[0].Unmarshal(str, &dst); err != ErrClosed {
+				done <- err
+				return
+			}
+		}
+		done <- ErrClosed
+	}()
+	select {
+	case err := <-done:
+		if err != ErrClosed {
+			t.Errorf("decoding after Close gave %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("decoding after Close got stuck")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines still running after Close, started with %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type unsupportedType struct {
+	Name    string
+	Channel chan int
+	Func    func()
+	Complex complex128
+	Reader  io.Reader
+	Grid    map[[2]int]string
+}
+
+func TestUnsupportedTypes(t *testing.T) {
+	var dst unsupportedType
+	if err := Unmarshal([]byte(`{"Name": "fine", "Channel": null, "Grid": null}`), &dst); err != nil || dst.Name != "fine" {
+		t.Errorf("couldn't decode around unsupported fields: %v %#v", err, dst)
+	}
+
+	for _, src := range []string{`{"Channel": 1}`, `{"Func": {}}`, `{"Complex": 1.5}`, `{"Reader": "x"}`, `{"Grid": {}}`} {
+		var unsupported *UnsupportedTypeError
+		err := Unmarshal([]byte(src), &dst)
+		if !errors.As(err, &unsupported) {
+			t.Errorf("%s gave %v", src, err)
+			continue
+		}
+		t.Logf("%s gave %v", src, err)
+	}
+
+	// the same errors come back the second time, without learning anything again
+	for i := 0; i < 2; i++ {
+		err := CheckType(&dst)
+		var unsupported *UnsupportedTypeError
+		if !errors.As(err, &unsupported) || unsupported.Type != reflect.TypeOf(dst.Channel) {
+			t.Errorf("CheckType gave %v", err)
+		}
+		if ReportPlan(&dst).Err() == nil {
+			t.Error("ReportPlan didn't notice the unsupported fields")
+		}
+	}
+	if err := CheckType(&recursiveType{}); err != nil {
+		t.Errorf("CheckType failed a fine type: %v", err)
+	}
+
+	if _, err := Marshal(dst); err == nil {
+		t.Error("wrote a channel")
+	}
+	if out, err := Marshal(map[string]interface{}{"a": make(chan int)}); err == nil || out != nil {
+		t.Errorf("wrote %q along with %v", out, err)
+	}
+
+	// interfaces with methods can't be decoded into, but they can still be written
+	for _, v := range []interface{}{
+		struct {
+			R io.Reader
+			E error
+		}{},
+		struct {
+			R io.Reader
+			E error
+		}{R: strings.NewReader("x"), E: &UnsupportedTypeError{Reason: "why"}},
+	} {
+		mine, err := Marshal(v)
+		theirs, err2 := json.Marshal(v)
+		t.Logf("mine: %s, theirs: %s", mine, theirs)
+		if err != nil || err2 != nil || string(mine) != string(theirs) {
+			t.Errorf("wrote %s, %v, expected %s", mine, err, theirs)
+		}
+	}
+	if err := Unmarshal([]byte(`{}`), nil); err != ErrNotPointer {
+		t.Errorf("unmarshalling into nil gave %v", err)
+	}
+	if err := NewDescriber().CheckType(nil); err == nil {
+		t.Error("nil type passed the check")
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	cases := []struct {
+		src          string
+		err          error
+		line, column int
+	}{
+		{"{\n  \"Amazing\": \"yes\",\n  \"Count\" 3\n}", ErrNoColon, 3, 10},
+		{`{"Amazing": "line \q"}`, ErrInvalidEscape, 1, 19},
+		{"[\n\ttrue,\n\tfalse,\n\tfals\n]", ErrNoBool, 4, 2},
+		{`{"Amazing": "never closed`, ErrNoQuote, 1, 26},
+		{`{"Amazing": "closed"`, ErrNoBrace, 1, 21},
+		{"[true,\r\nfalse", ErrNoBracket, 2, 6},
+	}
+	for _, c := range cases {
+		var dst interface{} = &struct {
+			Amazing string
+			Count   int
+		}{}
+		if c.err == ErrNoBool || c.err == ErrNoBracket {
+			dst = &[]bool{}
+		}
+		err := Unmarshal([]byte(c.src), dst)
+
+		var syntax *SyntaxError
+		if !errors.As(err, &syntax) {
+			t.Errorf("%q gave %v", c.src, err)
+			continue
+		}
+		t.Logf("%q gave %v near %q", c.src, err, syntax.Snippet)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%q should have been %v", c.src, c.err)
+		}
+		if syntax.Line != c.line || syntax.Column != c.column {
+			t.Errorf("%q should have been at line %d column %d", c.src, c.line, c.column)
+		}
+		if !strings.Contains(c.src, syntax.Snippet) || syntax.Offset > len(c.src) {
+			t.Errorf("%q has a bad offset or snippet", c.src)
+		}
+	}
+}
+
+func TestTruncatedInput(t *testing.T) {
+	// each of these stops right after a value, where the loop goes back for the next one
+	for _, src := range []string{`[1,2`, `["a", "b"`, `[[1], [2]`, `{"a":1`, `{"Name": "x", "SomeList": ["y"]`, `{"Nested": {"Amazing": "z"}`} {
+		var list []interface{}
+		var obj testType
+		var fixed []int
+		err := Unmarshal([]byte(src), &list)
+		err2 := Unmarshal([]byte(src), &obj)
+		err3 := Unmarshal([]byte(src), &fixed)
+		t.Logf("%s gave %v, %v, %v", src, err, err2, err3)
+		if err == nil || err2 == nil || err3 == nil {
+			t.Errorf("%s decoded without an error", src)
+		}
+	}
+
+	if ids := quickScan([]byte(`{"a": "b"`)); len(ids) != 2 {
+		t.Errorf("quickScan found %v", ids)
+	}
+}
+
+type itemType struct {
+	Price float64 `json:"price"`
+}
+
+type orderType struct {
+	Items []itemType          `json:"items"`
+	Notes map[string][]string `json:"notes"`
+}
+
+type ordersType struct {
+	Orders [4]orderType           `json:"orders"`
+	Extra  map[string]interface{} `json:"extra"`
+}
+
+func TestErrorPaths(t *testing.T) {
+	cases := []struct {
+		src, path, field string
+		goType           reflect.Type
+		err              error
+	}{
+		{`{"orders": [{}, {}, {}, {"items": [{"price": -}]}]}`, `$.orders[3].items[0].price`, `Orders.Items.Price`, reflect.TypeOf(0.0), ErrNoDigits},
+		{`{"orders": [{"notes": {"a b": ["x", "\q"]}}]}`, `$.orders[0].notes["a b"][1]`, `Orders.Notes`, reflect.TypeOf(""), ErrInvalidEscape},
+		{`{"orders": [{"notes": {"": ["\q"]}}]}`, `$.orders[0].notes[""][0]`, `Orders.Notes`, reflect.TypeOf(""), ErrInvalidEscape},
+		{`{"extra": {"deep": [1, {"x": tru}]}}`, `$.extra.deep[1].x`, `Extra`, reflect.TypeOf([]interface{}{}).Elem(), ErrNoBool},
+		{`{"orders": [{"items": [{"price": ]}]}`, `$.orders[0].items[0].price`, `Orders.Items.Price`, reflect.TypeOf(0.0), ErrUnexpectedListEnd},
+	}
+	for _, c := range cases {
+		var dst ordersType
+		err := Unmarshal([]byte(c.src), &dst)
+		t.Logf("%s gave %v", c.src, err)
+
+		var pathErr *PathError
+		if !errors.As(err, &pathErr) {
+			t.Errorf("no path in %v", err)
+			continue
+		}
+		if pathErr.Path != c.path || pathErr.Field != c.field || pathErr.Type != c.goType {
+			t.Errorf("expected %s in %s (%s), got %s in %s (%s)", c.path, c.field, c.goType, pathErr.Path, pathErr.Field, pathErr.Type)
+		}
+		var syntax *SyntaxError
+		if !errors.Is(err, c.err) || !errors.As(err, &syntax) {
+			t.Errorf("lost the underlying error %v", c.err)
+		}
+	}
+
+	// so do mismatches that were skipped, even under an empty key
+	var skipped ordersType
+	err := NewDescriber(SkipMismatches()).Unmarshal([]byte(`{"orders": [{"notes": {"": [1]}}]}`), &skipped)
+	var skippedErr *PathError
+	if !errors.As(err, &skippedErr) || skippedErr.Path != `$.orders[0].notes[""][0]` {
+		t.Errorf("skipped mismatch gave %v", err)
+	}
+
+	// errors that didn't come from inside anything don't get a path
+	var dst []int
+	err = Unmarshal([]byte(`{`), &dst)
+	var pathErr *PathError
+	if errors.As(err, &pathErr) {
+		t.Errorf("top level error got a path: %v", err)
+	}
+}
+
+type mismatchType struct {
+	Name  string
+	Count int
+	Ratio float32
+	On    bool
+	Tags  []string
+	Pair  [2]int
+	Ptr   *int
+	Inner struct {
+		X float64
+	}
+	Scores map[string]int
+	Any    interface{}
+	Small  int8
+	Whole  big.Int
+}
+
+func TestTypeMismatches(t *testing.T) {
+	cases := []struct {
+		src, value, path string
+		goType           reflect.Type
+	}{
+		{`{"Name": {"Evil": "value"}}`, "object", "$.Name", reflect.TypeOf("")},
+		{`{"Count": "12"}`, "string", "$.Count", reflect.TypeOf(0)},
+		{`{"Ratio": true}`, "bool", "$.Ratio", reflect.TypeOf(float32(0))},
+		{`{"On": 1}`, "number", "$.On", reflect.TypeOf(true)},
+		{`{"Tags": {"a": "b"}}`, "object", "$.Tags", reflect.TypeOf([]string{})},
+		{`{"Tags": ["a", ["b"]]}`, "array", "$.Tags[1]", reflect.TypeOf("")},
+		{`{"Pair": "12"}`, "string", "$.Pair", reflect.TypeOf([2]int{})},
+		{`{"Ptr": [1]}`, "array", "$.Ptr", reflect.TypeOf(0)},
+		{`{"Inner": 5}`, "number", "$.Inner", reflect.TypeOf(struct{ X float64 }{})},
+		{`{"Scores": {"a": false}}`, "bool", "$.Scores.a", reflect.TypeOf(0)},
+		{`{"Count": 1.5}`, "number 1.5", "$.Count", reflect.TypeOf(0)},
+		{`{"Count": -2e3}`, "number -2e3", "$.Count", reflect.TypeOf(0)},
+		{`{"Small": 300}`, "number 300", "$.Small", reflect.TypeOf(int8(0))},
+		{`{"Ratio": 1e39}`, "number 1e39", "$.Ratio", reflect.TypeOf(float32(0))},
+		{`{"Whole": 2.5}`, "number 2.5", "$.Whole", reflect.TypeOf(big.Int{})},
+	}
+	for _, c := range cases {
+		var dst mismatchType
+		err := Unmarshal([]byte(c.src), &dst)
+		t.Logf("%s gave %v", c.src, err)
+
+		var mismatch *UnmarshalTypeError
+		var pathErr *PathError
+		if !errors.As(err, &mismatch) || !errors.As(err, &pathErr) {
+			t.Errorf("%s gave %v", c.src, err)
+			continue
+		}
+		if mismatch.Value != c.value || mismatch.Type != c.goType || pathErr.Path != c.path {
+			t.Errorf("expected a %s into %s at %s", c.value, c.goType, c.path)
+		}
+		if jsonKind(c.src[mismatch.Offset]) != strings.Fields(c.value)[0] {
+			t.Errorf("offset %d isn't the start of the %s", mismatch.Offset, c.value)
+		}
+		if dst.Name != "" {
+			t.Errorf("stored %q anyway", dst.Name)
+		}
+	}
+
+	var list []int
+	err := Unmarshal([]byte(` "nope"`), &list)
+	var mismatch *UnmarshalTypeError
+	if !errors.As(err, &mismatch) || mismatch.Type != reflect.TypeOf(list) || mismatch.Offset != 1 {
+		t.Errorf("top level mismatch gave %v", err)
+	}
+	var small int8
+	err = Unmarshal([]byte("\n\n  300"), &small)
+	if !errors.As(err, &mismatch) || mismatch.Offset != 4 || mismatch.Value != "number 300" {
+		t.Errorf("out of range number gave %v", err)
+	}
+
+	// carrying on should end up with the same as encoding/json, and the same first error
+	src := []byte(`{"Name": 1, "Count": 2, "Tags": ["a", 3, "c"], "Pair": [4, "5", 6], "Inner": {"X": "7"},
+		"Scores": {"x": 1, "y": [], "z": 3}, "On": true, "Any": {"still": ["fine"]}}`)
+	var mine, theirs mismatchType
+	mineErr := NewDescriber(SkipMismatches()).Unmarshal(src, &mine)
+	theirsErr := json.Unmarshal(src, &theirs)
+	t.Logf("mine: %v, theirs: %v", mineErr, theirsErr)
+	if !reflect.DeepEqual(mine, theirs) {
+		t.Errorf("different outcomes, mine: %#v theirs: %#v", mine, theirs)
+	}
+	var pathErr *PathError
+	if !errors.As(mineErr, &pathErr) || pathErr.Path != "$.Name" || !errors.As(mineErr, &mismatch) {
+		t.Errorf("expected the first mismatch, got %v", mineErr)
+	}
+
+	// numbers of the wrong shape are skipped too
+	src = []byte(`{"Count": 1.5, "Name": "x", "Small": 300, "On": true}`)
+	var shaped, shapedTheirs mismatchType
+	mineErr = NewDescriber(SkipMismatches()).Unmarshal(src, &shaped)
+	theirsErr = json.Unmarshal(src, &shapedTheirs)
+	t.Logf("mine: %v, theirs: %v", mineErr, theirsErr)
+	if !reflect.DeepEqual(shaped, shapedTheirs) || !errors.As(mineErr, &pathErr) || pathErr.Path != "$.Count" {
+		t.Errorf("different outcomes, mine: %#v theirs: %#v", shaped, shapedTheirs)
+	}
+
+	var deep mismatchType
+	err = NewDescriber(SkipMismatches()).Unmarshal([]byte(`{"Scores": {"x": "1"}, "Name": 2}`), &deep)
+	if !errors.As(err, &pathErr) || pathErr.Path != "$.Scores.x" || pathErr.Field != "Scores" {
+		t.Errorf("expected the path of the first mismatch, got %v", err)
+	}
+}
+
+type strictType struct {
+	Amazing string
+	Numbers []int
+	Nested  map[string]interface{}
+}
+
+func TestStrict(t *testing.T) {
+	strict := NewDescriber(Strict())
+
+	good := []byte(` {"Amazing": "yes \u00e9", "Numbers": [1, -2, 300], "Nested": {"f": 30e-1, "a": [true, false, null, {}, []]}}` + "\r\n\t")
+	var mine, lenient, theirs strictType
+	if err := strict.Unmarshal(good, &mine); err != nil {
+		t.Fatal(err)
+	}
+	Unmarshal(good, &lenient)
+	json.Unmarshal(good, &theirs)
+	if !reflect.DeepEqual(mine, theirs) || !reflect.DeepEqual(lenient, theirs) {
+		t.Errorf("different outcomes, mine: %#v theirs: %#v", mine, theirs)
+	}
+
+	cases := []struct {
+		src    string
+		err    error
+		offset int
+	}{
+		{`{"Amazing": "x",}`, ErrNoQuoteOpen, 16},
+		{`{"Numbers": [1 2]}`, ErrNoComma, 15},
+		{`{"Numbers": [1,,2]}`, ErrNoValue, 15},
+		{`{"Numbers": [1,]}`, ErrNoValue, 15},
+		{`{"Numbers": [01]}`, ErrInvalidNumber, 13},
+		{`{,"Amazing": "x"}`, ErrNoQuoteOpen, 1},
+		{`{"Amazing": = "x"}`, ErrNoValue, 12},
+		{`{"Amazing": "x"} {}`, ErrTrailingData, 17},
+		{`{"Amazing" = "x"}`, ErrNoColon, 11},
+		{`{"Nested": {"a": [}}`, ErrNoValue, 18},
+		{`{"Amazing": "x"`, ErrNoBrace, 15},
+		{``, ErrUnexpectedEOF, 0},
+		{strings.Repeat("[", maxDepth+1), ErrTooDeep, maxDepth},
+	}
+	for _, c := range cases {
+		var dst strictType
+		err := strict.Unmarshal([]byte(c.src), &dst)
+		var syntax *SyntaxError
+		if !errors.As(err, &syntax) || !errors.Is(err, c.err) || syntax.Offset != c.offset {
+			t.Errorf("%.40s should have been %v at %d, got %v", c.src, c.err, c.offset, err)
+		}
+		if json.Unmarshal([]byte(c.src), &dst) == nil {
+			t.Errorf("encoding/json accepts %.40s", c.src)
+		}
+	}
+
+	// the lenient default still lets these through
+	var dst strictType
+	if err := Unmarshal([]byte(`{"Amazing": = "x", "Numbers": [1 2,]}`), &dst); err != nil || dst.Amazing != "x" || len(dst.Numbers) != 2 {
+		t.Errorf("lenient decode gave %v %#v", err, dst)
+	}
+}
+
+func TestValid(t *testing.T) {
+	docs := []string{
+		`{}`, `[]`, `""`, `0`, `-0.5e+10`, `true`, `null`, ` [1, "two", {"three": [false]}] `,
+		string(str), string(strWithList), `"\ud83d\ude00 \/ \\"`, `{"a": {"b": {"c": []}}}`,
+		``, ` `, `{`, `[1,]`, `{"a" 1}`, `{"a": 1,}`, `01`, `1.`, `-`, `tru`, `nul`, `"\x"`, "\"\x01\"",
+		`[1] [2]`, `{"a": 1}}`, `[}`, `'single'`, `{a: 1}`, `[1 2]`, `"unterminated`, `1e`, `.5`,
+	}
+	for _, doc := range docs {
+		mine, theirs := Valid([]byte(doc)), json.Valid([]byte(doc))
+		if mine != theirs {
+			t.Errorf("%q: Valid gave %t, encoding/json gave %t", doc, mine, theirs)
+		}
+
+		err := Validate([]byte(doc))
+		var syntax *SyntaxError
+		if mine && err != nil || !mine && !errors.As(err, &syntax) {
+			t.Errorf("%q: Validate gave %v", doc, err)
+		}
+	}
+
+	err := Validate([]byte("{\n  \"a\": [1,\n    2 3]\n}"))
+	var syntax *SyntaxError
+	if !errors.As(err, &syntax) || !errors.Is(err, ErrNoComma) || syntax.Line != 3 || syntax.Column != 7 {
+		t.Errorf("Validate gave %v", err)
+	}
+}
+
+type serverConfig struct {
+	Host    string
+	Timeout int `json:"timeout"`
+}
+
+type configType struct {
+	Name    string
+	Servers []serverConfig
+	Extra   map[string]interface{}
+}
+
+func TestUnknownFields(t *testing.T) {
+	src := []byte(`{"Name": "prod", "Servers": [{"Host": "a"}, {"Host": "b", "timeout": 5, "retries": 3}],
+		"Extra": {"anything": "goes"}, "Verbose": true}`)
+
+	var strict configType
+	err := NewDescriber(DisallowUnknownFields()).Unmarshal(src, &strict)
+	t.Logf("disallowed: %v", err)
+	var unknown *UnknownFieldError
+	if !errors.As(err, &unknown) || unknown.Key != "retries" || unknown.Type != reflect.TypeOf(serverConfig{}) ||
+		unknown.Path != "$.Servers[1].retries" || string(src[unknown.Offset:unknown.Offset+9]) != `"retries"` {
+		t.Errorf("expected the unknown key retries, got %v", err)
+	}
+
+	var theirs configType
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.DisallowUnknownFields()
+	if dec.Decode(&theirs) == nil {
+		t.Error("encoding/json accepted it")
+	}
+
+	var mine configType
+	warnings, err := UnmarshalWithWarnings(src, &mine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(src, &theirs)
+	if !reflect.DeepEqual(mine, theirs) {
+		t.Errorf("different outcomes, mine: %#v theirs: %#v", mine, theirs)
+	}
+	var paths []string
+	for _, w := range warnings {
+		t.Logf("warning: %v", w)
+		paths = append(paths, w.Path)
+	}
+	if strings.Join(paths, " ") != "$.Servers[1].retries $.Verbose" {
+		t.Errorf("expected two warnings, got %v", paths)
+	}
+
+	// without asking, unknown keys are still skipped quietly
+	if err := Unmarshal(src, &mine); err != nil {
+		t.Error(err)
+	}
+	if warnings, err := UnmarshalWithWarnings([]byte(`{"Name": "x"}`), &mine); err != nil || len(warnings) != 0 {
+		t.Errorf("expected no warnings, got %v %v", warnings, err)
+	}
+}
+
 func TestNilPtr(t *testing.T) {
 	var dst *string
 	Unmarshal([]byte(`"hi"`), dst)
@@ -98,6 +1382,155 @@ func TestInterface(t *testing.T) {
 	}
 }
 
+func TestInterfaceValues(t *testing.T) {
+	src := []byte(`{"int": 1, "neg": -2.5, "exp": 1e3, "yes": true, "no": false, "nothing": null,
+		"list": [0, null, true, "s", {"deep": -0.0001}], "obj": {}}`)
+
+	var mine, theirs interface{}
+	if err := Unmarshal(src, &mine); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(src, &theirs)
+	t.Logf("mine: %#v", mine)
+	if !reflect.DeepEqual(mine, theirs) {
+		t.Errorf("different outcomes, theirs: %#v", theirs)
+	}
+
+	out, _ := Marshal(mine)
+	theirsOut, _ := json.Marshal(theirs)
+	if string(out) != string(theirsOut) {
+		t.Errorf("wrote %s, expected %s", out, theirsOut)
+	}
+
+	// unknown keys get skipped with the same handler
+	var obj simpleType
+	if err := Unmarshal([]byte(`{"a": 12, "b": [1, -2, {"c": 3e4}], "d": null, "Name": "after"}`), &obj); err != nil {
+		t.Error(err)
+	}
+	if obj.Name != "after" {
+		t.Errorf("got %#v", obj)
+	}
+
+	// and so do numbers in keys that don't match a field
+	var tagged, taggedTheirs taggedType
+	src = []byte(`{"UserID": 8, "user_id": 7, "plain": "p"}`)
+	err := Unmarshal(src, &tagged)
+	json.Unmarshal(src, &taggedTheirs)
+	if err != nil || tagged != taggedTheirs {
+		t.Errorf("got %#v, %v, theirs: %#v", tagged, err, taggedTheirs)
+	}
+
+	var hidden, hiddenTheirs unexportedType
+	src = []byte(`{"hiddenInt": 1, "VisibleInt": 2, "Name": "n"}`)
+	err = Unmarshal(src, &hidden)
+	json.Unmarshal(src, &hiddenTheirs)
+	if err != nil || hidden != hiddenTheirs {
+		t.Errorf("got %#v, %v, theirs: %#v", hidden, err, hiddenTheirs)
+	}
+}
+
+type numberTextType struct {
+	ID    Number
+	Other Number
+}
+
+func TestUseNumber(t *testing.T) {
+	src := []byte(`{"id": 12345678901234567890, "small": 1, "ratio": -1.50e3, "list": [7]}`)
+
+	d := NewDescriber(UseNumber())
+	defer d.Close()
+	var mine interface{}
+	if err := d.Unmarshal(src, &mine); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("mine: %#v", mine)
+
+	m := mine.(map[string]interface{})
+	id, ok := m["id"].(Number)
+	if !ok || id.String() != "12345678901234567890" {
+		t.Errorf("id = %#v", m["id"])
+	}
+	if _, err := id.Int64(); err == nil {
+		t.Error("id shouldn't fit in an int64")
+	}
+	if small, err := m["small"].(Number).Int64(); err != nil || small != 1 {
+		t.Errorf("small = %d, %s", small, err)
+	}
+	if ratio, err := m["ratio"].(Number).Float64(); err != nil || ratio != -1500 {
+		t.Errorf("ratio = %f, %s", ratio, err)
+	}
+	if !reflect.DeepEqual(m["list"], []interface{}{Number("7")}) {
+		t.Errorf("list = %#v", m["list"])
+	}
+
+	out, err := d.Marshal(mine)
+	if err != nil || string(out) != `{"id":12345678901234567890,"list":[7],"ratio":-1.50e3,"small":1}` {
+		t.Errorf("wrote %s, %s", out, err)
+	}
+
+	// the standard describer isn't affected
+	var standardResult interface{}
+	Unmarshal(src, &standardResult)
+	if _, ok := standardResult.(map[string]interface{})["small"].(float64); !ok {
+		t.Errorf("standard describer is using numbers: %#v", standardResult)
+	}
+
+	var fields numberTextType
+	if err := Unmarshal([]byte(`{"ID": 98765432109876543210, "Other": null}`), &fields); err != nil || fields.ID != "98765432109876543210" {
+		t.Errorf("got %#v, %s", fields, err)
+	}
+}
+
+type ledgerType struct {
+	Balance  *big.Int
+	Total    big.Int
+	Rate     *big.Float
+	Share    *big.Rat
+	Fraction big.Rat
+	Missing  *big.Int
+}
+
+func TestBigNumbers(t *testing.T) {
+	src := []byte(`{"Balance": -123456789012345678901234567890, "Total": 1e3, "Rate": 3.14159265358979323846264338327950288,
+		"Share": 0.000000000000000000001, "Fraction": -12.5e-1, "Missing": null}`)
+
+	var mine ledgerType
+	if err := Unmarshal(src, &mine); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("mine: %#v", mine)
+
+	if mine.Balance.String() != "-123456789012345678901234567890" || mine.Total.String() != "1000" {
+		t.Errorf("ints = %s, %s", mine.Balance, &mine.Total)
+	}
+	if mine.Rate.Text('g', 36) != "3.14159265358979323846264338327950288" {
+		t.Errorf("float = %s", mine.Rate.Text('g', 36))
+	}
+	if mine.Share.String() != "1/1000000000000000000000" || mine.Fraction.String() != "-5/4" {
+		t.Errorf("rats = %s, %s", mine.Share, &mine.Fraction)
+	}
+	if mine.Missing != nil {
+		t.Errorf("missing = %s", mine.Missing)
+	}
+
+	out, err := Marshal(mine)
+	expected := `{"Balance":-123456789012345678901234567890,"Total":1000,"Rate":3.14159265358979323846264338327950288,` +
+		`"Share":0.000000000000000000001,"Fraction":-1.25,"Missing":null}`
+	if err != nil || string(out) != expected {
+		t.Errorf("wrote %s, %s", out, err)
+	}
+
+	third := ledgerType{Share: big.NewRat(1, 3)}
+	if out, _ := Marshal(third); !strings.Contains(string(out), `"Share":0.3333333333333333`) {
+		t.Errorf("wrote %s", out)
+	}
+
+	var notWhole ledgerType
+	if err := Unmarshal([]byte(`{"Balance": 1.5}`), &notWhole); err == nil {
+		t.Errorf("decoded a fraction into a big.Int: %s", notWhole.Balance)
+	}
+}
+
 func TestCorrectnessMixed(t *testing.T) {
 	for _, str := range [][]byte{str, str1, str2, str3} {
 		obj := &testType{SomeList: []string{"im already here"}, Tags: map[string]string{"temp": "temp"}}
@@ -199,6 +1632,67 @@ func TestCorrectness3(t *testing.T) {
 	}
 }
 
+func TestMarshal(t *testing.T) {
+	obj := &testType{
+		Name:       "world",
+		Food:       "quotes \" and \\ and \n",
+		Tags:       map[string]string{"b": "yay", "a": "lol"},
+		Nested:     &nested{Amazing: "yeah i know"},
+		SomeList:   []string{"yay", "wow"},
+		EmptyList:  []string{},
+		SurpriseMe: []interface{}{map[string]interface{}{"here": "today"}, ""},
+	}
+
+	mine, err := Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs, _ := json.Marshal(obj)
+
+	t.Logf("mine: \n%s", mine)
+	t.Logf("theirs: \n%s", theirs)
+	if string(mine) != string(theirs) {
+		t.Error("different outcomes")
+	}
+
+	back := &testType{}
+	if err := Unmarshal(mine, back); err != nil {
+		t.Fatal(err)
+	}
+	if back.Name != obj.Name || back.Nested.Amazing != obj.Nested.Amazing || len(back.SomeList) != 2 {
+		t.Errorf("round trip lost something: %#v", back)
+	}
+
+	cases := []blobType{
+		{Data: []byte("hi"), Text: "<b>fish & chips</b>"},
+		{Data: []byte{0, 0xff, 0xfe}, Text: "line\u2028and\u2029para"},
+		{Data: []byte{}, Text: ""},
+		{},
+	}
+	for _, c := range cases {
+		mine, err := Marshal(c)
+		theirs, err2 := json.Marshal(c)
+		t.Logf("mine: %s, err: %v", mine, err)
+		t.Logf("theirs: %s, err2: %v", theirs, err2)
+		if string(mine) != string(theirs) || (err == nil) != (err2 == nil) {
+			t.Error("different outcomes")
+		}
+
+		var back, back2 blobType
+		err = Unmarshal(mine, &back)
+		err2 = json.Unmarshal(theirs, &back2)
+		t.Logf("back: %#v, err: %v", back, err)
+		if !reflect.DeepEqual(back, back2) || (err == nil) != (err2 == nil) {
+			t.Error("different outcomes decoding")
+		}
+	}
+}
+
+type blobType struct {
+	Data []byte
+	Text string
+}
+
 var jsoni = jsoniter.ConfigFastest
 
 func TestEasyUnmarshal(t *testing.T) {
@@ -217,6 +1711,18 @@ func BenchmarkQuickScan(b *testing.B) {
 	}
 }
 
+func BenchmarkValid_Libfor(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Valid(strWithList)
+	}
+}
+
+func BenchmarkValid_StdlibJson(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		json.Valid(strWithList)
+	}
+}
+
 func BenchmarkSerially_Libfor(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		t := &testType{SomeList: []string{"already in"}}